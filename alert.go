@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+const (
+	CHECK_TYPE_HEARTBEAT = "heartbeat"
+	CHECK_TYPE_PING      = "ping"
+	CHECK_TYPE_HDD       = "hdd"
+
+	SEVERITY_CRITICAL = "critical"
+	SEVERITY_WARNING  = "warning"
+
+	ALERT_STATE_OK     = "ok"
+	ALERT_STATE_FIRING = "firing"
+
+	// Shown in /status only, alerts stay ok or firing
+	ALERT_STATE_MAINTENANCE = "maintenance"
+	ALERT_STATE_UNREACHABLE = "unreachable"
+
+	ALERT_EVENT_FIRING   = "firing"
+	ALERT_EVENT_REMINDER = "reminder"
+	ALERT_EVENT_RESOLVED = "resolved"
+	ALERT_EVENT_REPORT   = "report"
+
+	// Alerts held back by the rate limit of a hook
+	ALERT_EVENT_SUPPRESSED = "suppressed"
+)
+
+type AlertManager struct {
+	mutex  sync.Mutex
+	table  map[string]*Alert
+	labels []LabelRule
+}
+
+// LabelRule puts labels on matching alerts, used for grouping and templates.
+type LabelRule struct {
+	AlertMatcher
+	Labels map[string]string `json:"labels"`
+}
+
+type Alert struct {
+	Key            string            `json:"key"`
+	NodeName       string            `json:"node_name"`
+	NodeIpAddr     string            `json:"node_ip_addr"`
+	CheckType      string            `json:"check_type"`
+	ItemID         string            `json:"item_id"`
+	ItemName       string            `json:"item_name"`
+	Severity       string            `json:"severity"`
+	Labels         map[string]string `json:"labels"`
+	State          string            `json:"state"`
+	StartsAt       time.Time         `json:"starts_at"`
+	EndsAt         time.Time         `json:"ends_at"`
+	LastNotifiedAt time.Time         `json:"last_notified_at"`
+	IncidentID     string            `json:"incident_id"`
+	Item           interface{}       `json:"item"`
+
+	// Reported by the node of the item
+	Remediations []*RemediationResult `json:"remediations,omitempty"`
+}
+
+type AlertEvent struct {
+	Kind     string    `json:"kind"`
+	OldState string    `json:"old_state"`
+	NewState string    `json:"new_state"`
+	Time     time.Time `json:"time"`
+	Alert    Alert     `json:"alert"`
+
+	// Alerts combined by AlertGrouper
+	Group []*AlertEvent `json:"group,omitempty"`
+}
+
+func (self *AlertManager) Init() error {
+	self.table = make(map[string]*Alert)
+
+	if ALERT_LABELS_JSON != "" {
+		b, err := ioutil.ReadFile(ALERT_LABELS_JSON)
+		if err != nil {
+			LogFatal("Can not read %s file (%v).", ALERT_LABELS_JSON, err)
+			return err
+		}
+
+		if err := json.Unmarshal(b, &self.labels); err != nil {
+			LogFatal("Error on %s file unmarshal (%v).", ALERT_LABELS_JSON, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// AlertItem is a checked item of a node as seen by alerts.
+type AlertItem struct {
+	CheckType string
+	ID        string
+	Name      string
+	Severity  string
+	IsProblem bool
+	State     *CheckState
+	Item      interface{}
+}
+
+// AlertItems lists the items of a node of a check type, all types if empty.
+func AlertItems(node *NodeData, checkType string) []AlertItem {
+	var items []AlertItem
+	if checkType == "" || checkType == CHECK_TYPE_HEARTBEAT {
+		for _, x := range node.HeartbeatItems {
+			items = append(items, AlertItem{CHECK_TYPE_HEARTBEAT, x.ID, x.Name, SEVERITY_CRITICAL, !x.IsOnline, &x.CheckState, x})
+		}
+	}
+	if checkType == "" || checkType == CHECK_TYPE_PING {
+		for _, x := range node.PingItems {
+			items = append(items, AlertItem{CHECK_TYPE_PING, x.IpAddr, x.Name, SEVERITY_CRITICAL, !x.IsOnline, &x.CheckState, x})
+		}
+	}
+	if checkType == "" || checkType == CHECK_TYPE_HDD {
+		for _, x := range node.HddItems {
+			items = append(items, AlertItem{CHECK_TYPE_HDD, x.Path, x.Name, SEVERITY_WARNING, x.IsWarning, &x.CheckState, x})
+		}
+	}
+	return items
+}
+
+// NewAlert is the alert of the item without state, used for matching.
+func (self *AlertItem) NewAlert(node *NodeData) *Alert {
+	return &Alert{
+		Key:        fmt.Sprintf("%s/%s/%s", node.Name, self.CheckType, self.ID),
+		NodeName:   node.Name,
+		NodeIpAddr: node.IpAddr,
+		CheckType:  self.CheckType,
+		ItemID:     self.ID,
+		ItemName:   self.Name,
+		Severity:   self.Severity,
+		Item:       self.Item,
+	}
+}
+
+func (self *AlertManager) CheckHeartBeat(node *NodeData) {
+	self.check(node, CHECK_TYPE_HEARTBEAT)
+}
+
+func (self *AlertManager) CheckPing(node *NodeData) {
+	self.check(node, CHECK_TYPE_PING)
+}
+
+func (self *AlertManager) CheckHdd(node *NodeData) {
+	self.check(node, CHECK_TYPE_HDD)
+}
+
+func (self *AlertManager) check(node *NodeData, checkType string) {
+	for _, x := range AlertItems(node, checkType) {
+		isMuted := x.State.IsFlapping
+		if x.IsProblem {
+			alert := x.NewAlert(node)
+			if reason := self.MuteReason(alert); reason != "" {
+				LogDebug("Alert %s muted by %s", alert.Key, reason)
+				isMuted = true
+			}
+		}
+
+		self.Observe(node, x.CheckType, x.ID, x.Name, x.Severity, x.IsProblem, isMuted, x.Item)
+	}
+}
+
+// MuteReason returns why a failing alert is not notified, empty if it is.
+// Escalations skip their steps for the same reasons.
+func (self *AlertManager) MuteReason(alert *Alert) string {
+	if w := mw.Find(alert); w != nil {
+		return "maintenance " + w.Name
+	}
+	if s := sl.Find(alert); s != nil {
+		return "silence " + s.ID
+	}
+	if parent := dp.FindParent(alert); parent != nil {
+		return "unreachable " + parent.Key
+	}
+	if dp.Hold(alert, self.FiringSince(alert.Key), time.Now()) {
+		return "dependency hold"
+	}
+	return ""
+}
+
+// Annotate sets the alert state and silence of the items of nodes for /status.
+func (self *AlertManager) Annotate(nodes []*NodeData) {
+	for _, node := range nodes {
+		for _, x := range AlertItems(node, "") {
+			alert := x.NewAlert(node)
+
+			x.State.State = ALERT_STATE_OK
+			incidentID := ""
+			self.mutex.Lock()
+			if v := self.table[alert.Key]; v != nil {
+				x.State.State = v.State
+				if v.State == ALERT_STATE_FIRING {
+					incidentID = v.IncidentID
+				}
+			}
+			self.mutex.Unlock()
+
+			x.State.Incident = inc.Get(incidentID)
+
+			if mw.Find(alert) != nil {
+				x.State.State = ALERT_STATE_MAINTENANCE
+			} else if x.IsProblem && dp.FindParent(alert) != nil {
+				x.State.State = ALERT_STATE_UNREACHABLE
+			}
+
+			x.State.Silence = nil
+			if sl != nil {
+				x.State.Silence = sl.Find(alert)
+			}
+		}
+	}
+}
+
+// Observe moves the alert of an item through ok -> firing -> ok and
+// notifies only on firing, reminder and resolved transitions.
+// A muted alert keeps its state but is notified once it is unmuted.
+func (self *AlertManager) Observe(node *NodeData, checkType string, id string, name string, severity string, isProblem bool, isMuted bool, item interface{}) {
+	key := fmt.Sprintf("%s/%s/%s", node.Name, checkType, id)
+	now := time.Now()
+
+	self.mutex.Lock()
+
+	alert := self.table[key]
+	if alert == nil {
+		if !isProblem {
+			self.mutex.Unlock()
+			inc.CloseStale(key, now)
+			return
+		}
+
+		alert = &Alert{
+			Key:       key,
+			NodeName:  node.Name,
+			CheckType: checkType,
+			ItemID:    id,
+			State:     ALERT_STATE_OK,
+		}
+		self.table[key] = alert
+	}
+
+	alert.NodeIpAddr = node.IpAddr
+	alert.ItemName = name
+	alert.Severity = severity
+	alert.Item = item
+	alert.Labels = self.matchLabels(alert)
+
+	remediated := newRemediations(alert.Remediations, Remediations(item))
+	alert.Remediations = Remediations(item)
+
+	oldState := alert.State
+	kind := ""
+
+	if isProblem {
+		if alert.State != ALERT_STATE_FIRING {
+			alert.State = ALERT_STATE_FIRING
+			alert.StartsAt = now
+			alert.EndsAt = time.Time{}
+			alert.LastNotifiedAt = time.Time{}
+			alert.IncidentID = inc.Open(alert)
+		} else {
+			inc.AddTrace(alert.IncidentID, PingTrace(item))
+		}
+
+		if alert.LastNotifiedAt.IsZero() {
+			kind = ALERT_EVENT_FIRING
+		} else if ALERT_REMIND_INTERVAL_SECONDS > 0 && now.Sub(alert.LastNotifiedAt) >= time.Second*time.Duration(ALERT_REMIND_INTERVAL_SECONDS) &&
+			!inc.IsQuiet(alert.IncidentID) {
+			kind = ALERT_EVENT_REMINDER
+		}
+
+		if isMuted && kind != "" {
+			LogDebug("Alert muted %s", key)
+			kind = ""
+		}
+	} else if alert.State == ALERT_STATE_FIRING {
+		alert.State = ALERT_STATE_OK
+		alert.EndsAt = now
+		inc.Close(alert.IncidentID, now)
+
+		if !alert.LastNotifiedAt.IsZero() {
+			kind = ALERT_EVENT_RESOLVED
+		}
+	}
+
+	if kind != "" {
+		alert.LastNotifiedAt = now
+	}
+	for _, v := range remediated {
+		inc.AddNote(alert.IncidentID, "remediation", v.String())
+	}
+	event := &AlertEvent{
+		Kind:     kind,
+		OldState: oldState,
+		NewState: alert.State,
+		Time:     now,
+		Alert:    *alert,
+	}
+
+	self.mutex.Unlock()
+
+	// Muted transitions are audited without a kind
+	if event.OldState != event.NewState {
+		au.Transition(event)
+	}
+	if kind == "" {
+		return
+	}
+
+	LogInfo("Alert %s on %s (%s -> %s)", kind, key, event.OldState, event.NewState)
+	self.dispatch(event)
+}
+
+// FiringSince returns the start of a firing alert, zero if not firing.
+func (self *AlertManager) FiringSince(key string) time.Time {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if v := self.table[key]; v != nil && v.State == ALERT_STATE_FIRING {
+		return v.StartsAt
+	}
+	return time.Time{}
+}
+
+// ListFiring returns copies of the firing alerts matching matcher other than except.
+func (self *AlertManager) ListFiring(matcher *AlertMatcher, except string) []*Alert {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	var alerts []*Alert
+	for key, v := range self.table {
+		if key != except && v.State == ALERT_STATE_FIRING && matcher.Match(v) {
+			alert := *v
+			alerts = append(alerts, &alert)
+		}
+	}
+	return alerts
+}
+
+// newRemediations are the finished results of current not in old.
+func newRemediations(old []*RemediationResult, current []*RemediationResult) []*RemediationResult {
+	var results []*RemediationResult
+	for _, v := range current {
+		if v.Result == REMEDIATION_RESULT_RUNNING {
+			continue
+		}
+
+		found := false
+		for _, o := range old {
+			if o.Action == v.Action && o.StartsAt.Equal(v.StartsAt) && o.Result == v.Result {
+				found = true
+				break
+			}
+		}
+		if !found {
+			results = append(results, v)
+		}
+	}
+	return results
+}
+
+func (self *AlertManager) matchLabels(alert *Alert) map[string]string {
+	labels := make(map[string]string)
+	for i := range self.labels {
+		if self.labels[i].Match(alert) {
+			for k, v := range self.labels[i].Labels {
+				labels[k] = v
+			}
+		}
+	}
+	return labels
+}
+
+func (self *AlertManager) dispatch(event *AlertEvent) {
+	if ag != nil {
+		ag.Add(event)
+	} else if wh != nil {
+		wh.Notify(event)
+	}
+}
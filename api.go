@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
@@ -23,6 +25,24 @@ func (self *Api) Run() {
 		Handler: router,
 	}
 
+	if IS_SSL_ENABLE && SSL_CLIENT_CA != "" {
+		b, err := ioutil.ReadFile(SSL_CLIENT_CA)
+		if err != nil {
+			LogFatal("Can not read %s file (%v).", SSL_CLIENT_CA, err)
+			return
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			LogFatal("No certificate in %s file.", SSL_CLIENT_CA)
+			return
+		}
+		srv.TLSConfig = &tls.Config{
+			ClientCAs:  pool,
+			ClientAuth: tls.RequireAndVerifyClientCert,
+		}
+	}
+
 	go func() {
 		if IS_SSL_ENABLE {
 			if err := srv.ListenAndServeTLS(SSL_CERT_FILE, SSL_KEY_FILE); err != nil && err != http.ErrServerClosed {
@@ -67,12 +87,35 @@ func (self *Api) setupRouter() *gin.Engine {
 	if IS_MASTER {
 		r.GET("/status", ctr.Status)
 
+		r.GET("/silences", sl.List)
+		r.POST("/silences", sl.Create)
+		r.DELETE("/silences/:id", sl.Delete)
+
+		r.GET("/incidents", inc.List)
+		r.GET("/incidents/:id", inc.Show)
+		r.POST("/incidents/:id/ack", inc.Ack)
+		r.POST("/incidents/:id/resolve", inc.Resolve)
+		r.POST("/incidents/:id/notes", inc.Note)
+
+		r.GET("/notifications", au.List)
+
 		r.POST("/ping", ctr.Ping)
 		r.POST("/hdd", ctr.Hdd)
 
 		if IS_HB_ENABLE {
 			r.POST("/hb/:id", hb.Ping)
 		}
+
+		if IS_WEB_HOOK_ENABLE {
+			r.GET("/deliveries", dq.Stats)
+			r.GET("/deadletters", dq.DeadLetters)
+			r.POST("/deadletters/:id/replay", dq.Replay)
+			r.DELETE("/deadletters/:id", dq.Delete)
+
+			r.GET("/escalations", es.Status)
+
+			r.POST("/webhooks/:name/test", wh.Test)
+		}
 	}
 
 	return r
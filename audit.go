@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	AUDIT_TYPE_TRANSITION   = "transition"
+	AUDIT_TYPE_NOTIFICATION = "notification"
+
+	AUDIT_RESULT_DELIVERED   = "delivered"
+	AUDIT_RESULT_FAILED      = "failed"
+	AUDIT_RESULT_DEAD_LETTER = "dead_letter"
+	AUDIT_RESULT_DRY_RUN     = "dry_run"
+
+	AUDIT_DEFAULT_LIMIT = 100
+	AUDIT_MAX_LIMIT     = 1000
+)
+
+// AuditLog records alert state transitions and notification attempts
+// as JSON lines in AUDIT_PATH, kept for AUDIT_KEEP_DAYS.
+type AuditLog struct {
+	mutex   sync.Mutex
+	entries []*AuditEntry
+}
+
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	AlertKey  string    `json:"alert_key"`
+	NodeName  string    `json:"node_name"`
+	CheckType string    `json:"check_type"`
+	ItemName  string    `json:"item_name"`
+	Kind      string    `json:"kind,omitempty"`
+	OldState  string    `json:"old_state,omitempty"`
+	NewState  string    `json:"new_state,omitempty"`
+
+	Hook       string `json:"hook,omitempty"`
+	DeliveryID string `json:"delivery_id,omitempty"`
+	Attempt    int    `json:"attempt,omitempty"`
+	Result     string `json:"result,omitempty"`
+	Status     int    `json:"status,omitempty"`
+	Latency    int64  `json:"latency_mills,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Output     string `json:"output,omitempty"`
+}
+
+type AuditPage struct {
+	Total  int           `json:"total"`
+	Offset int           `json:"offset"`
+	Limit  int           `json:"limit"`
+	Items  []*AuditEntry `json:"items"`
+}
+
+func (self *AuditLog) Init() {
+	if f, err := os.Open(AUDIT_PATH); err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var entry AuditEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+				self.entries = append(self.entries, &entry)
+			}
+		}
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		LogFatal("Can not read %s file (%v).", AUDIT_PATH, err)
+	}
+
+	self.mutex.Lock()
+	self.prune()
+	self.mutex.Unlock()
+
+	LogInfo("Audit log has loaded %d entries.", len(self.entries))
+}
+
+func (self *AuditLog) Run() {
+	for RUNNING {
+		<-time.After(time.Hour)
+
+		self.mutex.Lock()
+		self.prune()
+		self.mutex.Unlock()
+	}
+}
+
+// Transition records a state change of an alert, notified or not.
+func (self *AuditLog) Transition(event *AlertEvent) {
+	self.add(&AuditEntry{
+		Time:      event.Time,
+		Type:      AUDIT_TYPE_TRANSITION,
+		AlertKey:  event.Alert.Key,
+		NodeName:  event.Alert.NodeName,
+		CheckType: event.Alert.CheckType,
+		ItemName:  event.Alert.ItemName,
+		Kind:      event.Kind,
+		OldState:  event.OldState,
+		NewState:  event.NewState,
+	})
+}
+
+// Attempt records a delivery attempt of a notification.
+func (self *AuditLog) Attempt(d *Delivery, result string, latency time.Duration) {
+	entry := &AuditEntry{
+		Time:       time.Now(),
+		Type:       AUDIT_TYPE_NOTIFICATION,
+		Hook:       d.Hook,
+		DeliveryID: d.ID,
+		Attempt:    d.Attempts,
+		Result:     result,
+		Status:     d.LastStatus,
+		Latency:    latency.Milliseconds(),
+		Error:      d.LastError,
+		Output:     d.LastOutput,
+	}
+	if d.Event != nil {
+		entry.AlertKey = d.Event.Alert.Key
+		entry.NodeName = d.Event.Alert.NodeName
+		entry.CheckType = d.Event.Alert.CheckType
+		entry.ItemName = d.Event.Alert.ItemName
+		entry.Kind = d.Event.Kind
+	}
+	self.add(entry)
+}
+
+func (self *AuditLog) add(entry *AuditEntry) {
+	if self == nil {
+		return
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.entries = append(self.entries, entry)
+
+	f, err := os.OpenFile(AUDIT_PATH, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		LogFatal("Can not write %s file (%v).", AUDIT_PATH, err)
+		return
+	}
+	f.Write(append(b, '\n'))
+	f.Close()
+}
+
+// prune drops entries older than AUDIT_KEEP_DAYS and rewrites the file,
+// must be called with the mutex held.
+func (self *AuditLog) prune() {
+	if AUDIT_KEEP_DAYS <= 0 {
+		return
+	}
+
+	before := time.Now().AddDate(0, 0, -AUDIT_KEEP_DAYS)
+	n := 0
+	for n < len(self.entries) && self.entries[n].Time.Before(before) {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	self.entries = append([]*AuditEntry{}, self.entries[n:]...)
+
+	f, err := os.Create(AUDIT_PATH + ".tmp")
+	if err != nil {
+		LogFatal("Can not write %s file (%v).", AUDIT_PATH, err)
+		return
+	}
+
+	w := bufio.NewWriter(f)
+	for _, v := range self.entries {
+		if b, err := json.Marshal(v); err == nil {
+			w.Write(append(b, '\n'))
+		}
+	}
+	w.Flush()
+	f.Close()
+
+	if err := os.Rename(AUDIT_PATH+".tmp", AUDIT_PATH); err != nil {
+		LogFatal("Can not write %s file (%v).", AUDIT_PATH, err)
+	}
+}
+
+// List pages through entries newest first, filtered by type, hook, node,
+// check_type, key, kind and result, and since/until in RFC 3339.
+func (self *AuditLog) List(c *gin.Context) {
+	var since, until time.Time
+	var err error
+	if v := c.Query("since"); v != "" {
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid since."})
+			return
+		}
+	}
+	if v := c.Query("until"); v != "" {
+		if until, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid until."})
+			return
+		}
+	}
+
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = AUDIT_DEFAULT_LIMIT
+	} else if limit > AUDIT_MAX_LIMIT {
+		limit = AUDIT_MAX_LIMIT
+	}
+
+	filters := map[string]string{}
+	for _, k := range []string{"type", "hook", "node", "check_type", "key", "kind", "result"} {
+		if v := c.Query(k); v != "" {
+			filters[k] = v
+		}
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	page := AuditPage{Offset: offset, Limit: limit, Items: []*AuditEntry{}}
+	for i := len(self.entries) - 1; i >= 0; i-- {
+		v := self.entries[i]
+		if (!since.IsZero() && v.Time.Before(since)) || (!until.IsZero() && v.Time.After(until)) || !v.match(filters) {
+			continue
+		}
+
+		if page.Total >= offset && len(page.Items) < limit {
+			page.Items = append(page.Items, v)
+		}
+		page.Total++
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func (self *AuditEntry) match(filters map[string]string) bool {
+	for k, v := range filters {
+		var value string
+		switch k {
+		case "type":
+			value = self.Type
+		case "hook":
+			value = self.Hook
+		case "node":
+			value = self.NodeName
+		case "check_type":
+			value = self.CheckType
+		case "key":
+			value = self.AlertKey
+		case "kind":
+			value = self.Kind
+		case "result":
+			value = self.Result
+		}
+		if value != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func setTestAuditLog(t *testing.T, keepDays int) *AuditLog {
+	oldAu, oldPath, oldKeep := au, AUDIT_PATH, AUDIT_KEEP_DAYS
+	t.Cleanup(func() { au, AUDIT_PATH, AUDIT_KEEP_DAYS = oldAu, oldPath, oldKeep })
+
+	AUDIT_PATH = filepath.Join(t.TempDir(), "audit.jsonl")
+	AUDIT_KEEP_DAYS = keepDays
+	au = &AuditLog{}
+	au.Init()
+	return au
+}
+
+// count is the number of entries, under the mutex for the delivery workers.
+func (self *AuditLog) count() int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return len(self.entries)
+}
+
+// readAuditFile decodes the lines of AUDIT_PATH.
+func readAuditFile(t *testing.T) []*AuditEntry {
+	f, err := os.Open(AUDIT_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var entries []*AuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("line is not JSON (%v): %s", err, scanner.Text())
+		}
+		entries = append(entries, &entry)
+	}
+	return entries
+}
+
+func TestAuditLogRecords(t *testing.T) {
+	audit := setTestAuditLog(t, 30)
+	setTestDependencies(t)
+
+	// A failing item records its transition
+	am.CheckPing(newPingNode("DB1", "8.8.8.8", false))
+	if n := audit.count(); n != 1 {
+		t.Fatalf("%d entries after the transition", n)
+	}
+
+	stub := newStubServer(t, http.StatusOK)
+	dq := newTestDeliveryQueue(t, []WebHookItem{
+		{Name: "ok", Type: NOTIFIER_TYPE_SLACK, EndPoint: stub.URL},
+		{Name: "down", Type: NOTIFIER_TYPE_SLACK, EndPoint: "http://127.0.0.1:1", MaxAttempts: 1},
+	})
+	dq.Enqueue("ok", newNotifierEvent(), map[string]string{"text": "a"})
+	dq.Enqueue("down", newNotifierEvent(), map[string]string{"text": "a"})
+	waitFor(t, "attempts", func() bool { return audit.count() == 4 })
+
+	entries := readAuditFile(t)
+	if len(entries) != 4 {
+		t.Fatalf("%d lines, want 4", len(entries))
+	}
+
+	transition := entries[0]
+	if transition.Type != AUDIT_TYPE_TRANSITION || transition.AlertKey != "DB1/ping/8.8.8.8" || transition.Kind != ALERT_EVENT_FIRING ||
+		transition.OldState != ALERT_STATE_OK || transition.NewState != ALERT_STATE_FIRING {
+		t.Errorf("transition %+v", transition)
+	}
+
+	results := map[string]int{}
+	for _, v := range entries[1:] {
+		if v.Type != AUDIT_TYPE_NOTIFICATION || v.AlertKey != "MAIN/ping/8.8.8.8" || v.DeliveryID == "" || v.Attempt != 1 {
+			t.Errorf("attempt %+v", v)
+		}
+		results[v.Hook+" "+v.Result]++
+	}
+	if results["ok delivered"] != 1 || results["down failed"] != 1 || results["down dead_letter"] != 1 {
+		t.Errorf("results %v", results)
+	}
+
+	// The file is appended to and loaded again
+	audit.Transition(newNotifierEvent())
+	if entries := readAuditFile(t); len(entries) != 5 {
+		t.Errorf("%d lines after an append, want 5", len(entries))
+	}
+
+	loaded := &AuditLog{}
+	loaded.Init()
+	if n := loaded.count(); n != 5 {
+		t.Errorf("%d entries loaded, want 5", n)
+	}
+}
+
+func callAuditList(audit *AuditLog, query string) (int, *AuditPage) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/notifications?"+query, nil)
+	audit.List(c)
+
+	var page AuditPage
+	json.Unmarshal(w.Body.Bytes(), &page)
+	return w.Code, &page
+}
+
+func TestAuditLogList(t *testing.T) {
+	audit := setTestAuditLog(t, 0)
+
+	base := time.Date(2024, 3, 13, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		event := newNotifierEvent()
+		event.Time = base.Add(time.Duration(i) * time.Minute)
+		if i%2 == 1 {
+			event.Alert.NodeName = "DB1"
+			event.Kind = ALERT_EVENT_RESOLVED
+		}
+		audit.Transition(event)
+	}
+	audit.Attempt(&Delivery{ID: "d1", Hook: "pager", Attempts: 2, LastStatus: 500, Event: newNotifierEvent()}, AUDIT_RESULT_FAILED, 0)
+
+	tests := []struct {
+		query string
+		total int
+		first string
+		items int
+	}{
+		{"", 11, "notification", 11},
+		{"type=transition", 10, "transition", 10},
+		{"hook=pager&result=failed", 1, "notification", 1},
+		{"node=DB1&kind=resolved", 5, "transition", 5},
+		{"node=DB1&kind=firing", 0, "", 0},
+		{"type=transition&since=2024-03-13T10:03:00Z&until=2024-03-13T10:06:00Z", 4, "transition", 4},
+		{"type=transition&limit=3", 10, "transition", 3},
+		{"type=transition&offset=8&limit=3", 10, "transition", 2},
+		{"type=transition&offset=20", 10, "", 0},
+		{"type=transition&offset=-1&limit=-1", 10, "transition", 10},
+	}
+
+	for _, test := range tests {
+		code, page := callAuditList(audit, test.query)
+		if code != http.StatusOK {
+			t.Errorf("%q: status %d", test.query, code)
+			continue
+		}
+		if page.Total != test.total || len(page.Items) != test.items {
+			t.Errorf("%q: total %d items %d, want %d %d", test.query, page.Total, len(page.Items), test.total, test.items)
+			continue
+		}
+		if test.items > 0 && page.Items[0].Type != test.first {
+			t.Errorf("%q: first %s, want %s", test.query, page.Items[0].Type, test.first)
+		}
+	}
+
+	// Newest first, offset skips the newest
+	_, page := callAuditList(audit, "type=transition&offset=1&limit=2")
+	if !page.Items[0].Time.Equal(base.Add(8*time.Minute)) || !page.Items[1].Time.Equal(base.Add(7*time.Minute)) {
+		t.Errorf("page %v %v", page.Items[0].Time, page.Items[1].Time)
+	}
+
+	for _, query := range []string{"since=yesterday", "until=2024-03-13"} {
+		if code, _ := callAuditList(audit, query); code != http.StatusBadRequest {
+			t.Errorf("%q: status %d, want %d", query, code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestAuditLogPrune(t *testing.T) {
+	audit := setTestAuditLog(t, 0)
+
+	now := time.Now()
+	for _, age := range []int{10, 8, 3, 0} {
+		event := newNotifierEvent()
+		event.Time = now.AddDate(0, 0, -age)
+		audit.Transition(event)
+	}
+
+	// KEEP_DAYS 0 keeps them all
+	kept := &AuditLog{}
+	kept.Init()
+	if n := kept.count(); n != 4 {
+		t.Fatalf("%d entries kept, want 4", n)
+	}
+
+	// Old entries are dropped on load and by the hourly prune
+	AUDIT_KEEP_DAYS = 7
+	loaded := &AuditLog{}
+	loaded.Init()
+	if n := loaded.count(); n != 2 {
+		t.Errorf("%d entries loaded, want 2", n)
+	}
+
+	audit.mutex.Lock()
+	audit.prune()
+	audit.mutex.Unlock()
+
+	if n := audit.count(); n != 2 {
+		t.Fatalf("%d entries after prune, want 2", n)
+	}
+	entries := readAuditFile(t)
+	if len(entries) != 2 || entries[0].Time.Before(now.AddDate(0, 0, -7)) {
+		t.Fatalf("file after prune %v", entries)
+	}
+	if _, err := os.Stat(AUDIT_PATH + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left (%v)", err)
+	}
+}
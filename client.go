@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const DEFAULT_TIMEOUT_SECONDS = 10
+
+// TLSOptions configures outbound TLS, verification is on unless InsecureSkipVerify.
+type TLSOptions struct {
+	CAFile             string `json:"ca_file"`
+	CertFile           string `json:"cert_file"`
+	KeyFile            string `json:"key_file"`
+	ServerName         string `json:"server_name"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+var defaultClient = &http.Client{
+	Timeout: time.Second * DEFAULT_TIMEOUT_SECONDS,
+}
+
+func (self *TLSOptions) Config() (*tls.Config, error) {
+	config := &tls.Config{}
+	if self == nil {
+		return config, nil
+	}
+
+	config.ServerName = self.ServerName
+	config.InsecureSkipVerify = self.InsecureSkipVerify
+
+	if self.CAFile != "" {
+		b, err := ioutil.ReadFile(self.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificate in %s", self.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if self.CertFile != "" || self.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(self.CertFile, self.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+func NewHttpClient(options *TLSOptions, timeoutSeconds int) (*http.Client, error) {
+	config, err := options.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	if timeoutSeconds <= 0 {
+		timeoutSeconds = DEFAULT_TIMEOUT_SECONDS
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+
+	return &http.Client{
+		Timeout:   time.Second * time.Duration(timeoutSeconds),
+		Transport: transport,
+	}, nil
+}
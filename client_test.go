@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testTLSFiles writes a test certificate as CA, cert and key files.
+type testTLSFiles struct {
+	cert     tls.Certificate
+	certPEM  []byte
+	caFile   string
+	certFile string
+	keyFile  string
+}
+
+func newTestTLSFiles(t *testing.T) *testTLSFiles {
+	cert, certPEM := newTestCertificate(t)
+
+	der, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	files := &testTLSFiles{
+		cert:     cert,
+		certPEM:  certPEM,
+		caFile:   filepath.Join(dir, "ca.pem"),
+		certFile: filepath.Join(dir, "cert.pem"),
+		keyFile:  filepath.Join(dir, "key.pem"),
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	for file, b := range map[string][]byte{files.caFile: certPEM, files.certFile: certPEM, files.keyFile: keyPEM} {
+		if err := ioutil.WriteFile(file, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+// newTestTLSServer serves the test certificate, requiring a client
+// certificate signed by it when clientAuth.
+func newTestTLSServer(t *testing.T, files *testTLSFiles, clientAuth bool, handler http.HandlerFunc) *httptest.Server {
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{files.cert}}
+	if clientAuth {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(files.certPEM)
+		server.TLS.ClientCAs = pool
+		server.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestNewHttpClientTLS(t *testing.T) {
+	files := newTestTLSFiles(t)
+	server := newTestTLSServer(t, files, false, okHandler)
+	mutual := newTestTLSServer(t, files, true, okHandler)
+
+	tests := []struct {
+		name    string
+		options *TLSOptions
+		url     string
+		wantErr string
+	}{
+		{"system roots", nil, server.URL, "certificate"},
+		{"custom CA", &TLSOptions{CAFile: files.caFile}, server.URL, ""},
+		{"wrong server name", &TLSOptions{CAFile: files.caFile, ServerName: "example.com"}, server.URL, "certificate"},
+		{"insecure", &TLSOptions{InsecureSkipVerify: true}, server.URL, ""},
+		{"no client certificate", &TLSOptions{CAFile: files.caFile}, mutual.URL, "tls"},
+		{"client certificate", &TLSOptions{CAFile: files.caFile, CertFile: files.certFile, KeyFile: files.keyFile}, mutual.URL, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewHttpClient(tt.options, 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := client.Get(tt.url)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				return
+			}
+			if err == nil {
+				resp.Body.Close()
+				t.Fatalf("no error, want %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTLSOptionsConfigErrors(t *testing.T) {
+	files := newTestTLSFiles(t)
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := ioutil.WriteFile(empty, []byte("no pem"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		options *TLSOptions
+	}{
+		{"missing CA file", &TLSOptions{CAFile: filepath.Join(t.TempDir(), "missing.pem")}},
+		{"no certificate in CA file", &TLSOptions{CAFile: empty}},
+		{"certificate without key", &TLSOptions{CertFile: files.certFile}},
+		{"key without certificate", &TLSOptions{KeyFile: files.keyFile}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.options.Config(); err == nil {
+				t.Fatal("no error")
+			}
+			if _, err := NewHttpClient(tt.options, 5); err == nil {
+				t.Fatal("no client error")
+			}
+		})
+	}
+}
+
+func TestNewHttpClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	client, err := NewHttpClient(nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Timeout != time.Second {
+		t.Fatalf("timeout %v, want 1s", client.Timeout)
+	}
+
+	start := time.Now()
+	if resp, err := client.Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("no timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("timed out after %v", elapsed)
+	}
+
+	client, err = NewHttpClient(nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Timeout != DEFAULT_TIMEOUT_SECONDS*time.Second {
+		t.Fatalf("default timeout %v, want %ds", client.Timeout, DEFAULT_TIMEOUT_SECONDS)
+	}
+}
+
+// Each web hook gets its own client, with its own TLS and timeout.
+func TestWebHookInitClients(t *testing.T) {
+	files := newTestTLSFiles(t)
+
+	WEB_HOOK_CONFIG_JSON = filepath.Join(t.TempDir(), "web_hooks.json")
+	config := `[{"name": "slow", "type": "webhook", "end_point": "http://127.0.0.1:1", "timeout_seconds": 30},
+		{"name": "default", "type": "webhook", "end_point": "http://127.0.0.1:1"},
+		{"name": "internal", "type": "webhook", "end_point": "https://127.0.0.1:1", "timeout_seconds": 2, "tls": {"ca_file": "` + files.caFile + `"}}]`
+	if err := ioutil.WriteFile(WEB_HOOK_CONFIG_JSON, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hook := &WebHook{}
+	if err := hook.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]time.Duration{"slow": 30 * time.Second, "default": DEFAULT_TIMEOUT_SECONDS * time.Second, "internal": 2 * time.Second}
+	for _, item := range hook.items {
+		if item.client.Timeout != want[item.Name] {
+			t.Errorf("%s: timeout %v, want %v", item.Name, item.client.Timeout, want[item.Name])
+		}
+		pool := item.client.Transport.(*http.Transport).TLSClientConfig.RootCAs
+		if hasCA := pool != nil; hasCA != (item.Name == "internal") {
+			t.Errorf("%s: custom CA %v", item.Name, hasCA)
+		}
+	}
+
+	config = `[{"name": "broken", "type": "webhook", "end_point": "https://127.0.0.1:1", "tls": {"cert_file": "` + files.certFile + `"}}]`
+	if err := ioutil.WriteFile(WEB_HOOK_CONFIG_JSON, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&WebHook{}).Init(); err == nil {
+		t.Error("web hook with a certificate and no key loaded")
+	}
+}
@@ -3,9 +3,14 @@ package main
 import (
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"sync"
 )
 
+// Collector keeps the latest report of each node. Reports are copied
+// by their senders and never changed once stored, only replaced under
+// the mutex, and /status serializes a copy of them.
 type Collector struct {
+	mutex sync.RWMutex
 	items []*NodeData
 	table map[string]*NodeData
 }
@@ -43,38 +48,88 @@ func (self *Collector) Hdd(c *gin.Context) {
 }
 
 func (self *Collector) ProcessHeartbeat(data NodeData) {
-	item := self.table[data.Name]
-	if item == nil {
-		self.table[data.Name] = &data
-		self.items = append(self.items, self.table[data.Name])
-	} else {
-		self.table[data.Name].HeartbeatItems = data.HeartbeatItems
-	}
-	wh.CheckHeartBeat(&data)
+	self.store(&data, func(node *NodeData) {
+		node.HeartbeatItems = data.HeartbeatItems
+	})
+	am.CheckHeartBeat(&data)
+	rp.Sample(&data)
 }
 
 func (self *Collector) ProcessPing(data NodeData) {
-	item := self.table[data.Name]
-	if item == nil {
-		self.table[data.Name] = &data
-		self.items = append(self.items, self.table[data.Name])
-	} else {
-		self.table[data.Name].PingItems = data.PingItems
-	}
-	wh.CheckPing(&data)
+	self.store(&data, func(node *NodeData) {
+		node.PingItems = data.PingItems
+	})
+	am.CheckPing(&data)
+	rp.Sample(&data)
 }
 
 func (self *Collector) ProcessHdd(data NodeData) {
-	item := self.table[data.Name]
-	if item == nil {
-		self.table[data.Name] = &data
-		self.items = append(self.items, self.table[data.Name])
-	} else {
-		self.table[data.Name].HddItems = data.HddItems
+	self.store(&data, func(node *NodeData) {
+		node.HddItems = data.HddItems
+	})
+	am.CheckHdd(&data)
+	rp.Sample(&data)
+}
+
+// store adds the report of a new node, or replaces the items of a known one by update.
+func (self *Collector) store(data *NodeData, update func(*NodeData)) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	node := self.table[data.Name]
+	if node == nil {
+		node = &NodeData{Name: data.Name}
+		self.table[data.Name] = node
+		self.items = append(self.items, node)
+	}
+	node.IpAddr = data.IpAddr
+	update(node)
+}
+
+// Snapshot copies the nodes and their items, the copies are free to change.
+func (self *Collector) Snapshot() []*NodeData {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	nodes := make([]*NodeData, 0, len(self.items))
+	for _, v := range self.items {
+		node := v.Copy()
+		nodes = append(nodes, &node)
 	}
-	wh.CheckHdd(&data)
+	return nodes
 }
 
 func (self *Collector) Status(c *gin.Context) {
-	c.JSON(http.StatusOK, self.items)
+	nodes := self.Snapshot()
+	am.Annotate(nodes)
+	c.JSON(http.StatusOK, nodes)
+}
+
+// Copy is a copy of the node with copies of its items, taken by the owner
+// of the items before handing a report to other goroutines.
+func (self *NodeData) Copy() NodeData {
+	node := *self
+
+	if self.HeartbeatItems != nil {
+		node.HeartbeatItems = make([]*HeartbeatItem, len(self.HeartbeatItems))
+		for i, v := range self.HeartbeatItems {
+			item := *v
+			node.HeartbeatItems[i] = &item
+		}
+	}
+	if self.PingItems != nil {
+		node.PingItems = make([]*PingItem, len(self.PingItems))
+		for i, v := range self.PingItems {
+			item := *v
+			node.PingItems[i] = &item
+		}
+	}
+	if self.HddItems != nil {
+		node.HddItems = make([]*HDDItem, len(self.HddItems))
+		for i, v := range self.HddItems {
+			item := *v
+			node.HddItems[i] = &item
+		}
+	}
+	return node
 }
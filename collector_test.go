@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestCollector(t *testing.T) *httptest.Server {
+	oldCtr, oldAm, oldAg := ctr, am, ag
+	t.Cleanup(func() { ctr, am, ag = oldCtr, oldAm, oldAg })
+
+	ctr = &Collector{}
+	ctr.Init()
+	am = &AlertManager{}
+	am.Init()
+	ag = newTestGrouper(t)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/status", ctr.Status)
+	r.POST("/ping", ctr.Ping)
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestReport(node string, i int) NodeData {
+	return NodeData{
+		Name:           node,
+		IpAddr:         "10.0.0.1",
+		HeartbeatItems: []*HeartbeatItem{{Name: "app", ID: "app", LastCheckTime: int64(i), IsOnline: i%2 == 0}},
+		PingItems:      []*PingItem{{Name: "dns", IpAddr: "8.8.8.8", LastRTT: int64(i), IsOnline: i%3 != 0}},
+		HddItems:       []*HDDItem{{Name: "root", Path: "/", Usage: float64(i), IsWarning: i%5 == 0}},
+	}
+}
+
+// Reports of every kind are stored and checked while /status is served.
+func TestCollectorConcurrentReports(t *testing.T) {
+	server := newTestCollector(t)
+	nodes := []string{"DB1", "DB2", "WEB1"}
+
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				report := newTestReport(node, i)
+				switch i % 3 {
+				case 0:
+					ctr.ProcessHeartbeat(report)
+				case 1:
+					ctr.ProcessPing(report)
+				case 2:
+					ctr.ProcessHdd(report)
+				}
+			}
+		}(node)
+	}
+
+	// Reports posted by nodes go through the same store
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			b, _ := json.Marshal(newTestReport("REMOTE", i))
+			resp, err := http.Post(server.URL+"/ping", "application/json", bytes.NewReader(b))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for polling := true; polling; {
+		select {
+		case <-done:
+			polling = false
+		default:
+		}
+
+		var status []*NodeData
+		resp, err := http.Get(server.URL + "/status")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&status)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %d (%v)", resp.StatusCode, err)
+		}
+	}
+
+	var status []*NodeData
+	resp, err := http.Get(server.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	json.NewDecoder(resp.Body).Decode(&status)
+
+	if len(status) != len(nodes)+1 {
+		t.Fatalf("%d nodes in status", len(status))
+	}
+	for _, node := range status {
+		if len(node.PingItems) != 1 {
+			t.Errorf("%s has %d ping items", node.Name, len(node.PingItems))
+		}
+		if node.Name != "REMOTE" && (len(node.HeartbeatItems) != 1 || len(node.HddItems) != 1) {
+			t.Errorf("%s has %d heartbeat and %d hdd items", node.Name, len(node.HeartbeatItems), len(node.HddItems))
+		}
+		if node.PingItems[0].State == "" {
+			t.Errorf("%s is not annotated", node.Name)
+		}
+	}
+}
+
+// Status annotates copies, stored reports keep their state.
+func TestCollectorStatusCopies(t *testing.T) {
+	newTestCollector(t)
+	ctr.ProcessPing(newTestReport("DB1", 0))
+
+	nodes := ctr.Snapshot()
+	nodes[0].PingItems[0].LastRTT = 999
+	am.Annotate(nodes)
+
+	if v := ctr.Snapshot()[0].PingItems[0]; v.LastRTT == 999 || v.State != "" {
+		t.Errorf("stored item changed %+v", v)
+	}
+}
+
+func newTestHeartbeat(ids ...string) *Heartbeat {
+	heartbeat := &Heartbeat{table: make(map[string]*HeartbeatItem)}
+	for _, id := range ids {
+		item := &HeartbeatItem{Name: id, ID: id}
+		heartbeat.items = append(heartbeat.items, item)
+		heartbeat.table[id] = item
+	}
+	return heartbeat
+}
+
+// Heartbeat pings of apps race the checks of the loop.
+func TestHeartbeatPingDuringCheck(t *testing.T) {
+	old := HB_TIMEOUT_SECONDS
+	HB_TIMEOUT_SECONDS = 60
+	t.Cleanup(func() { HB_TIMEOUT_SECONDS = old })
+
+	heartbeat := newTestHeartbeat("a", "b")
+	threshold := &Threshold{FailAfter: 1, RecoverAfter: 1}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/hb/:id", heartbeat.Ping)
+
+	var wg sync.WaitGroup
+	for _, id := range []string{"a", "b", "c"} {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/hb/"+id, nil))
+				if (w.Code == http.StatusOK) != (id != "c") {
+					t.Errorf("ping of %s: %d", id, w.Code)
+					return
+				}
+			}
+		}(id)
+	}
+
+	for i := 0; i < 100; i++ {
+		data := heartbeat.check(threshold)
+		data.HeartbeatItems[0].LastCheck = "changed"
+	}
+	wg.Wait()
+
+	data := heartbeat.check(threshold)
+	for _, v := range data.HeartbeatItems {
+		if !v.IsOnline || v.LastCheck == "changed" {
+			t.Errorf("%+v after pings", v)
+		}
+	}
+}
+
+// Replies of the pinger race the checks and reports of the loop.
+func TestPingReceiveDuringCheck(t *testing.T) {
+	old := PING_TIMEOUT_SECONDS
+	PING_TIMEOUT_SECONDS = 60
+	t.Cleanup(func() { PING_TIMEOUT_SECONDS = old })
+
+	ping := &Ping{table: make(map[string]*PingItem)}
+	for _, v := range []string{"10.0.0.1", "10.0.0.2"} {
+		item := &PingItem{Name: v, IpAddr: v}
+		ping.items = append(ping.items, item)
+		ping.table[v] = item
+	}
+	threshold := &Threshold{FailAfter: 1, RecoverAfter: 1}
+
+	var wg sync.WaitGroup
+	for _, v := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		wg.Add(1)
+		go func(addr *net.IPAddr) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				ping.receive(addr, time.Millisecond*time.Duration(i))
+			}
+		}(&net.IPAddr{IP: net.ParseIP(v)})
+	}
+
+	for i := 0; i < 100; i++ {
+		ping.check(threshold)
+		data := ping.report()
+		data.PingItems[0].LastRTT = -1
+	}
+	wg.Wait()
+
+	ping.check(threshold)
+	for _, v := range ping.report().PingItems {
+		if !v.IsOnline || v.LastRTT != 99 {
+			t.Errorf("%+v after replies", v)
+		}
+	}
+}
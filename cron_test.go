@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"a * * * *",
+		"5-1 * * * *",
+		"1-x * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"0,,30 * * * *",
+	} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("%q parsed", spec)
+		}
+	}
+}
+
+func TestCronMatch(t *testing.T) {
+	// 2024-03-13 is a wednesday
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 30, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec string
+		t    time.Time
+		want bool
+	}{
+		{"* * * * *", at(3, 13, 10, 7), true},
+		{"*/15 * * * *", at(3, 13, 10, 45), true},
+		{"*/15 * * * *", at(3, 13, 10, 46), false},
+		{"5/20 * * * *", at(3, 13, 10, 45), true},
+		{"5/20 * * * *", at(3, 13, 10, 40), false},
+		{"0,30 9-17 * * *", at(3, 13, 17, 30), true},
+		{"0,30 9-17 * * *", at(3, 13, 18, 0), false},
+		{"0 2 * * 1-5", at(3, 13, 2, 0), true},
+		{"0 2 * * 1-5", at(3, 16, 2, 0), false},
+		{"0 2 * * 0", at(3, 17, 2, 0), true},
+		{"0 2 * * 7", at(3, 17, 2, 0), true},
+		{"0 0 1 */3 *", at(4, 1, 0, 0), true},
+		{"0 0 1 */3 *", at(3, 1, 0, 0), false},
+		// Day-of-month or day-of-week when both are set
+		{"0 0 13 * 5", at(3, 13, 0, 0), true},
+		{"0 0 13 * 5", at(3, 15, 0, 0), true},
+		{"0 0 13 * 5", at(3, 14, 0, 0), false},
+		{"0 0 13 * *", at(3, 15, 0, 0), false},
+	}
+
+	for _, test := range tests {
+		c, err := ParseCron(test.spec)
+		if err != nil {
+			t.Fatalf("%q: %v", test.spec, err)
+		}
+		if got := c.Match(test.t); got != test.want {
+			t.Errorf("%q at %v: match %v, want %v", test.spec, test.t, got, test.want)
+		}
+	}
+}
+
+func TestCronPrevNext(t *testing.T) {
+	at := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name   string
+		spec   string
+		t      time.Time
+		within time.Duration
+		prev   time.Time
+		next   time.Time
+	}{
+		{"same minute", "0 * * * *", at(2024, 3, 13, 10, 0).Add(45 * time.Second), time.Hour, at(2024, 3, 13, 10, 0), at(2024, 3, 13, 11, 0)},
+		{"hour", "0 * * * *", at(2024, 3, 13, 10, 59), time.Hour, at(2024, 3, 13, 10, 0), at(2024, 3, 13, 11, 0)},
+		{"out of within", "0 * * * *", at(2024, 3, 13, 10, 59), 30 * time.Minute, time.Time{}, at(2024, 3, 13, 11, 0)},
+		{"day", "30 23 * * *", at(2024, 3, 14, 0, 10), time.Hour, at(2024, 3, 13, 23, 30), at(2024, 3, 14, 23, 30)},
+		{"month", "0 0 1 * *", at(2024, 2, 29, 23, 59), 31 * 24 * time.Hour, at(2024, 2, 1, 0, 0), at(2024, 3, 1, 0, 0)},
+		{"year", "0 12 31 12 *", at(2025, 1, 1, 11, 0), 24 * time.Hour, at(2024, 12, 31, 12, 0), at(2025, 12, 31, 12, 0)},
+		{"leap day", "0 0 29 2 *", at(2024, 3, 1, 0, 0), 48 * time.Hour, at(2024, 2, 29, 0, 0), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCron(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.Prev(tt.t, tt.within); !got.Equal(tt.prev) {
+				t.Errorf("prev %v, want %v", got, tt.prev)
+			}
+			if got := c.Next(tt.t); !got.Equal(tt.next) {
+				t.Errorf("next %v, want %v", got, tt.next)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// DeliveryQueue delivers payloads through a queue per web hook, retries
+// failures with exponential backoff and keeps what never arrived as dead letters.
+type DeliveryQueue struct {
+	mutex  sync.Mutex
+	queues map[string]chan *Delivery
+	stats  map[string]*DeliveryStats
+	dead   []*Delivery
+}
+
+type Delivery struct {
+	ID         string      `json:"id"`
+	Hook       string      `json:"hook"`
+	Event      *AlertEvent `json:"event"`
+	Payload    interface{} `json:"payload"`
+	Attempts   int         `json:"attempts"`
+	LastStatus int         `json:"last_status"`
+	LastError  string      `json:"last_error"`
+	LastOutput string      `json:"last_output,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	FailedAt   time.Time   `json:"failed_at"`
+}
+
+type DeliveryStats struct {
+	Queued          int64     `json:"queued"`
+	Attempts        int64     `json:"attempts"`
+	Delivered       int64     `json:"delivered"`
+	Failed          int64     `json:"failed"`
+	DeadLettered    int64     `json:"dead_lettered"`
+	LastStatus      int       `json:"last_status"`
+	LastError       string    `json:"last_error"`
+	LastLatency     int64     `json:"last_latency_mills"`
+	LastDeliveredAt time.Time `json:"last_delivered_at"`
+}
+
+func (self *DeliveryQueue) Init(items []WebHookItem) {
+	self.queues = make(map[string]chan *Delivery)
+	self.stats = make(map[string]*DeliveryStats)
+
+	if b, err := ioutil.ReadFile(DELIVERY_DEAD_LETTER_PATH); err == nil {
+		if err := json.Unmarshal(b, &self.dead); err != nil {
+			LogFatal("Error on %s file unmarshal (%v).", DELIVERY_DEAD_LETTER_PATH, err)
+		}
+	} else if !os.IsNotExist(err) {
+		LogFatal("Can not read %s file (%v).", DELIVERY_DEAD_LETTER_PATH, err)
+	}
+
+	for i := range items {
+		item := &items[i]
+		queue := make(chan *Delivery, DELIVERY_QUEUE_SIZE)
+
+		self.queues[item.Name] = queue
+		self.stats[item.Name] = &DeliveryStats{}
+		go self.worker(item, queue)
+	}
+
+	LogInfo("Delivery queue has loaded %d dead letters.", len(self.dead))
+}
+
+func (self *DeliveryQueue) Enqueue(hook string, event *AlertEvent, payload interface{}) {
+	self.push(&Delivery{
+		ID:        NewID(),
+		Hook:      hook,
+		Event:     event,
+		Payload:   payload,
+		CreatedAt: time.Now(),
+	})
+}
+
+func (self *DeliveryQueue) push(d *Delivery) {
+	self.mutex.Lock()
+	queue := self.queues[d.Hook]
+	stats := self.stats[d.Hook]
+	self.mutex.Unlock()
+
+	if queue == nil {
+		LogFatal("Delivery to unknown web hook %s dropped.", d.Hook)
+		return
+	}
+
+	select {
+	case queue <- d:
+		self.mutex.Lock()
+		stats.Queued++
+		self.mutex.Unlock()
+	default:
+		d.LastError = "queue is full"
+		self.deadLetter(d)
+	}
+}
+
+func (self *DeliveryQueue) worker(item *WebHookItem, queue chan *Delivery) {
+	for d := range queue {
+		self.deliver(item, d)
+	}
+}
+
+func (self *DeliveryQueue) deliver(item *WebHookItem, d *Delivery) {
+	// A command may have done its work before failing, it runs again only if asked
+	maxAttempts := item.MaxAttempts
+	if maxAttempts <= 0 && item.Type == NOTIFIER_TYPE_EXEC {
+		maxAttempts = 1
+	} else if maxAttempts <= 0 {
+		maxAttempts = DELIVERY_MAX_ATTEMPTS
+	}
+	backoff := time.Second * time.Duration(item.BackoffSeconds)
+	if backoff <= 0 {
+		backoff = time.Second * time.Duration(DELIVERY_BACKOFF_SECONDS)
+	}
+	maxBackoff := time.Second * time.Duration(DELIVERY_MAX_BACKOFF_SECONDS)
+
+	if DRY_RUN {
+		b, _ := json.Marshal(d.Payload)
+		LogInfo("Web hook %s dry run %s: %s", item.Name, d.ID, b)
+		au.Attempt(d, AUDIT_RESULT_DRY_RUN, 0)
+		return
+	}
+
+	for {
+		d.Attempts++
+		start := time.Now()
+		status, output, err := DeliverOutput(item.notifier, d.Payload)
+		latency := time.Since(start)
+
+		d.LastStatus = status
+		d.LastOutput = output
+		d.LastError = ""
+		result := AUDIT_RESULT_DELIVERED
+		if err != nil {
+			d.LastError = err.Error()
+			result = AUDIT_RESULT_FAILED
+		}
+		au.Attempt(d, result, latency)
+		self.record(item.Name, status, err, latency)
+
+		if err == nil {
+			LogDebug("Web hook %s delivered %s (%d, %dms)", item.Name, d.ID, status, latency.Milliseconds())
+			return
+		}
+
+		if d.Attempts >= maxAttempts || !RUNNING {
+			self.deadLetter(d)
+			return
+		}
+
+		wait := retryWait(backoff, maxBackoff, d.Attempts)
+		LogDebug("Web hook %s failed %s (%v), retry %d/%d in %v", item.Name, d.ID, err, d.Attempts, maxAttempts, wait)
+		<-time.After(wait)
+	}
+}
+
+// retryWait doubles backoff for each failed attempt up to maxBackoff.
+func retryWait(backoff time.Duration, maxBackoff time.Duration, attempts int) time.Duration {
+	wait := backoff << uint(attempts-1)
+	if wait > maxBackoff || wait <= 0 {
+		wait = maxBackoff
+	}
+	return wait
+}
+
+func (self *DeliveryQueue) record(hook string, status int, err error, latency time.Duration) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	stats := self.stats[hook]
+	stats.Attempts++
+	stats.LastStatus = status
+	stats.LastLatency = latency.Milliseconds()
+
+	if err != nil {
+		stats.Failed++
+		stats.LastError = err.Error()
+	} else {
+		stats.Delivered++
+		stats.LastError = ""
+		stats.LastDeliveredAt = time.Now()
+	}
+}
+
+func (self *DeliveryQueue) deadLetter(d *Delivery) {
+	d.FailedAt = time.Now()
+	LogFatal("Web hook %s gave up %s after %d attempts (%s)", d.Hook, d.ID, d.Attempts, d.LastError)
+	au.Attempt(d, AUDIT_RESULT_DEAD_LETTER, 0)
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if stats := self.stats[d.Hook]; stats != nil {
+		stats.DeadLettered++
+	}
+	self.dead = append(self.dead, d)
+	self.save()
+}
+
+func (self *DeliveryQueue) save() {
+	if err := SaveJson(DELIVERY_DEAD_LETTER_PATH, self.dead); err != nil {
+		LogFatal("Can not write %s file (%v).", DELIVERY_DEAD_LETTER_PATH, err)
+	}
+}
+
+func (self *DeliveryQueue) take(id string) *Delivery {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for i, v := range self.dead {
+		if v.ID == id {
+			self.dead = append(self.dead[:i], self.dead[i+1:]...)
+			self.save()
+			return v
+		}
+	}
+	return nil
+}
+
+func (self *DeliveryQueue) Stats(c *gin.Context) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	c.JSON(http.StatusOK, self.stats)
+}
+
+func (self *DeliveryQueue) DeadLetters(c *gin.Context) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	c.JSON(http.StatusOK, self.dead)
+}
+
+func (self *DeliveryQueue) Replay(c *gin.Context) {
+	id := c.Param("id")
+
+	self.mutex.Lock()
+	var hook string
+	for _, v := range self.dead {
+		if v.ID == id {
+			hook = v.Hook
+		}
+	}
+	queue := self.queues[hook]
+	self.mutex.Unlock()
+
+	if hook == "" {
+		c.JSON(http.StatusNotFound, gin.H{"message": "No matching dead letter."})
+		return
+	}
+	if queue == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "No matching web hook."})
+		return
+	}
+
+	d := self.take(id)
+	if d == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "No matching dead letter."})
+		return
+	}
+
+	d.Attempts = 0
+	d.FailedAt = time.Time{}
+	c.JSON(http.StatusOK, d)
+	self.push(d)
+}
+
+func (self *DeliveryQueue) Delete(c *gin.Context) {
+	d := self.take(c.Param("id"))
+	if d == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "No matching dead letter."})
+		return
+	}
+
+	c.JSON(http.StatusOK, d)
+}
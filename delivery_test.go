@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRetryWait(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 5 * time.Second},
+		{2, 10 * time.Second},
+		{3, 20 * time.Second},
+		{5, 60 * time.Second},
+		{80, 60 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := retryWait(5*time.Second, 60*time.Second, tt.attempts); got != tt.want {
+			t.Errorf("attempt %d: wait %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func newTestDeliveryQueue(t *testing.T, items []WebHookItem) *DeliveryQueue {
+	DELIVERY_DEAD_LETTER_PATH = filepath.Join(t.TempDir(), "dead_letters.json")
+	DELIVERY_QUEUE_SIZE = 10
+	DELIVERY_MAX_BACKOFF_SECONDS = 1
+
+	for i := range items {
+		items[i].notifier = newTestNotifier(t, &items[i])
+	}
+
+	dq := &DeliveryQueue{}
+	dq.Init(items)
+
+	// Workers left running would read the globals of the next tests
+	t.Cleanup(func() { waitFor(t, "deliveries to finish", dq.settled) })
+	return dq
+}
+
+// settled tells if every queued delivery was delivered or dead lettered.
+func (self *DeliveryQueue) settled() bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for _, v := range self.stats {
+		if v.Delivered+v.DeadLettered != v.Queued {
+			return false
+		}
+	}
+	return true
+}
+
+// waitFor polls cond until it holds or fails the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (self *DeliveryQueue) deadCount() int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return len(self.dead)
+}
+
+func callReplay(dq *DeliveryQueue, id string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "id", Value: id}}
+	dq.Replay(c)
+	return w
+}
+
+func TestDeliveryRetriesToDeadLetterAndReplay(t *testing.T) {
+	stub := newStubServer(t, http.StatusInternalServerError)
+	dq := newTestDeliveryQueue(t, []WebHookItem{
+		{Name: "hook", Type: NOTIFIER_TYPE_SLACK, EndPoint: stub.URL, MaxAttempts: 2, BackoffSeconds: 1},
+	})
+
+	start := time.Now()
+	dq.Enqueue("hook", newNotifierEvent(), map[string]string{"text": "a"})
+	waitFor(t, "dead letter", func() bool { return dq.deadCount() == 1 })
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want a backoff of 1s", elapsed)
+	}
+
+	stub.mutex.Lock()
+	requests := stub.requests
+	stub.mutex.Unlock()
+	if requests != 2 {
+		t.Fatalf("%d requests, want 2", requests)
+	}
+
+	dq.mutex.Lock()
+	d := dq.dead[0]
+	stats := *dq.stats["hook"]
+	dq.mutex.Unlock()
+	if d.Attempts != 2 || d.LastStatus != http.StatusInternalServerError || d.FailedAt.IsZero() {
+		t.Errorf("dead letter %+v", d)
+	}
+	if stats.Attempts != 2 || stats.Failed != 2 || stats.DeadLettered != 1 {
+		t.Errorf("stats %+v", stats)
+	}
+
+	// Kept on disk and loaded back
+	var saved []*Delivery
+	b, _ := ioutil.ReadFile(DELIVERY_DEAD_LETTER_PATH)
+	if err := json.Unmarshal(b, &saved); err != nil || len(saved) != 1 || saved[0].ID != d.ID {
+		t.Fatalf("saved %s (%v)", b, err)
+	}
+
+	stub.mutex.Lock()
+	stub.status = http.StatusOK
+	stub.mutex.Unlock()
+
+	if w := callReplay(dq, d.ID); w.Code != http.StatusOK {
+		t.Fatalf("replay %d %s", w.Code, w.Body)
+	}
+	waitFor(t, "replayed delivery", func() bool {
+		dq.mutex.Lock()
+		defer dq.mutex.Unlock()
+		return dq.stats["hook"].Delivered == 1
+	})
+
+	if dq.deadCount() != 0 {
+		t.Fatal("replayed dead letter is kept")
+	}
+	if body := stub.decoded(t); body["text"] != "a" {
+		t.Errorf("replayed body %v", body)
+	}
+	b, _ = ioutil.ReadFile(DELIVERY_DEAD_LETTER_PATH)
+	if err := json.Unmarshal(b, &saved); err != nil || len(saved) != 0 {
+		t.Fatalf("saved after replay %s (%v)", b, err)
+	}
+}
+
+func TestDeliveryReplayErrors(t *testing.T) {
+	dq := newTestDeliveryQueue(t, []WebHookItem{{Name: "hook", Type: NOTIFIER_TYPE_SLACK, EndPoint: "http://127.0.0.1:1"}})
+	dq.dead = []*Delivery{{ID: "gone", Hook: "removed"}}
+
+	if w := callReplay(dq, "none"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown id %d", w.Code)
+	}
+	if w := callReplay(dq, "gone"); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown hook %d", w.Code)
+	}
+	if dq.deadCount() != 1 {
+		t.Error("dead letter of an unknown hook is dropped")
+	}
+}
+
+func TestDeliveryQueueLoadsDeadLetters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead_letters.json")
+	if err := SaveJson(path, []*Delivery{{ID: "a", Hook: "hook"}, {ID: "b", Hook: "hook"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	DELIVERY_DEAD_LETTER_PATH = path
+	dq := &DeliveryQueue{}
+	dq.Init(nil)
+	if dq.deadCount() != 2 {
+		t.Fatalf("%d dead letters loaded, want 2", dq.deadCount())
+	}
+}
+
+func TestWebHookInitRejectsDuplicateNames(t *testing.T) {
+	WEB_HOOK_CONFIG_JSON = filepath.Join(t.TempDir(), "web_hooks.json")
+	config := `[{"name": "ops", "type": "slack", "end_point": "http://127.0.0.1:1"},
+		{"name": "ops", "type": "discord", "end_point": "http://127.0.0.1:1"}]`
+	if err := ioutil.WriteFile(WEB_HOOK_CONFIG_JSON, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&WebHook{}).Init(); err == nil {
+		t.Fatal("duplicate web hook names are accepted")
+	}
+}
+
+// Exec and paging hooks notify by item, so they are neither limited nor grouped.
+func TestWebHookInitLimitsGroupableHooks(t *testing.T) {
+	old := DELIVERY_RATE_PER_MINUTE
+	DELIVERY_RATE_PER_MINUTE = 10
+	t.Cleanup(func() { DELIVERY_RATE_PER_MINUTE = old })
+
+	WEB_HOOK_CONFIG_JSON = filepath.Join(t.TempDir(), "web_hooks.json")
+	config := `[{"name": "chat", "type": "slack", "end_point": "http://127.0.0.1:1"},
+		{"name": "script", "type": "exec", "command": "true"},
+		{"name": "pager", "type": "pagerduty", "routing_key": "key"}]`
+	if err := ioutil.WriteFile(WEB_HOOK_CONFIG_JSON, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hook := &WebHook{}
+	if err := hook.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, item := range hook.items {
+		if limited := item.limiter != nil; limited != item.IsGroupable() || limited != (item.Name == "chat") {
+			t.Errorf("%s: limited %v, groupable %v", item.Name, limited, item.IsGroupable())
+		}
+	}
+}
+
+// A failed command is not run again unless the hook asks for it.
+func TestDeliveryExecRunsOnce(t *testing.T) {
+	runs := filepath.Join(t.TempDir(), "runs")
+	dq := newTestDeliveryQueue(t, []WebHookItem{
+		{Name: "once", Type: NOTIFIER_TYPE_EXEC, Command: "sh", Args: []string{"-c", "echo once >> " + runs + "; exit 1"}, TimeoutSeconds: 10},
+		{Name: "twice", Type: NOTIFIER_TYPE_EXEC, Command: "sh", Args: []string{"-c", "echo twice >> " + runs + "; exit 1"}, TimeoutSeconds: 10, MaxAttempts: 2, BackoffSeconds: 1},
+	})
+
+	dq.Enqueue("once", newNotifierEvent(), &ExecPayload{})
+	dq.Enqueue("twice", newNotifierEvent(), &ExecPayload{})
+	waitFor(t, "dead letters", func() bool { return dq.deadCount() == 2 })
+
+	b, _ := ioutil.ReadFile(runs)
+	if n := strings.Count(string(b), "once\n"); n != 1 {
+		t.Errorf("default exec hook ran %d times", n)
+	}
+	if n := strings.Count(string(b), "twice\n"); n != 2 {
+		t.Errorf("exec hook of max_attempts 2 ran %d times", n)
+	}
+}
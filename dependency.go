@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// Dependencies suppress alerts of children while a parent is firing,
+// such as the targets behind a gateway or the nodes reporting through it.
+type Dependencies struct {
+	rules []DependencyRule
+}
+
+type DependencyRule struct {
+	Name     string       `json:"name"`
+	Parent   AlertMatcher `json:"parent"`
+	Children AlertMatcher `json:"children"`
+}
+
+func (self *Dependencies) Init() error {
+	if DEPENDENCY_CONFIG_JSON == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(DEPENDENCY_CONFIG_JSON)
+	if err != nil {
+		LogFatal("Can not read %s file (%v).", DEPENDENCY_CONFIG_JSON, err)
+		return err
+	}
+
+	if err := json.Unmarshal(b, &self.rules); err != nil {
+		LogFatal("Error on %s file unmarshal (%v).", DEPENDENCY_CONFIG_JSON, err)
+		return err
+	}
+
+	for i := range self.rules {
+		if self.rules[i].Name == "" {
+			self.rules[i].Name = fmt.Sprintf("dependency%d", i)
+		}
+	}
+
+	LogInfo("Dependencies has loaded %d rules.", len(self.rules))
+	return nil
+}
+
+// FindParent returns a firing parent alert of an alert, nil if every parent is up.
+// Parents depending on the alert in turn, such as nodes set as parents of each
+// other or two nodes pinging their gateway, do not count, else they mute each other.
+func (self *Dependencies) FindParent(alert *Alert) *Alert {
+	if self == nil {
+		return nil
+	}
+
+	for _, parent := range self.firingParents(alert) {
+		if !self.dependsOn(parent, alert.Key, map[string]bool{}) {
+			return parent
+		}
+	}
+	return nil
+}
+
+// dependsOn tells if key is a firing parent of alert, directly or through others.
+func (self *Dependencies) dependsOn(alert *Alert, key string, seen map[string]bool) bool {
+	seen[alert.Key] = true
+	for _, parent := range self.firingParents(alert) {
+		if parent.Key == key {
+			return true
+		}
+		if !seen[parent.Key] && self.dependsOn(parent, key, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *Dependencies) firingParents(alert *Alert) []*Alert {
+	var parents []*Alert
+	for i := range self.rules {
+		rule := &self.rules[i]
+		if rule.Children.Match(alert) {
+			parents = append(parents, am.ListFiring(&rule.Parent, alert.Key)...)
+		}
+	}
+	return parents
+}
+
+// Hold tells if a failing child alert firing since startsAt, zero if not yet,
+// waits for its parents. Reports come in any order, so a parent failing with it
+// may be firing only after the child is checked.
+func (self *Dependencies) Hold(alert *Alert, startsAt time.Time, now time.Time) bool {
+	if self == nil || DEPENDENCY_HOLD_SECONDS <= 0 {
+		return false
+	}
+
+	for i := range self.rules {
+		if self.rules[i].Children.Match(alert) {
+			return startsAt.IsZero() || now.Sub(startsAt) < time.Second*time.Duration(DEPENDENCY_HOLD_SECONDS)
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func setTestDependencies(t *testing.T, rules ...DependencyRule) *AlertManager {
+	oldAm, oldDp, oldAg, hold := am, dp, ag, DEPENDENCY_HOLD_SECONDS
+	t.Cleanup(func() { am, dp, ag, DEPENDENCY_HOLD_SECONDS = oldAm, oldDp, oldAg, hold })
+
+	am = &AlertManager{}
+	am.Init()
+	dp = &Dependencies{rules: rules}
+	ag = newTestGrouper(t)
+	DEPENDENCY_HOLD_SECONDS = 60
+	return am
+}
+
+var gatewayRule = DependencyRule{
+	Name:     "gateway",
+	Parent:   AlertMatcher{CheckTypes: []string{CHECK_TYPE_PING}, Items: []string{"10.0.0.254"}},
+	Children: AlertMatcher{Nodes: []string{"WEB*"}},
+}
+
+func TestDependenciesHold(t *testing.T) {
+	setTestDependencies(t, gatewayRule)
+	now := time.Now()
+
+	tests := []struct {
+		node     string
+		startsAt time.Time
+		want     bool
+	}{
+		{"WEB1", time.Time{}, true},
+		{"WEB1", now.Add(-time.Second * 59), true},
+		{"WEB1", now.Add(-time.Second * 60), false},
+		{"DB1", time.Time{}, false},
+	}
+
+	for _, test := range tests {
+		if got := dp.Hold(&Alert{NodeName: test.node}, test.startsAt, now); got != test.want {
+			t.Errorf("%s since %v: hold %v", test.node, test.startsAt, got)
+		}
+	}
+
+	DEPENDENCY_HOLD_SECONDS = 0
+	if dp.Hold(&Alert{NodeName: "WEB1"}, time.Time{}, now) {
+		t.Error("held with HOLD_SECONDS 0")
+	}
+}
+
+// The child of a cycle is reported before its parent and must not page.
+func TestDependencyChildBeforeParent(t *testing.T) {
+	manager := setTestDependencies(t, gatewayRule)
+	grouper := ag
+
+	manager.CheckPing(newPingNode("WEB1", "8.8.8.8", false))
+	manager.CheckPing(newPingNode("MAIN", "10.0.0.254", false))
+	if pending := grouper.pending(); len(pending) != 1 || pending["firing/MAIN"] != 1 {
+		t.Fatalf("pending %v", pending)
+	}
+
+	// Past the hold the parent is firing, the child stays unreachable
+	manager.mutex.Lock()
+	manager.table["WEB1/ping/8.8.8.8"].StartsAt = time.Now().Add(-time.Hour)
+	manager.mutex.Unlock()
+
+	manager.CheckPing(newPingNode("WEB1", "8.8.8.8", false))
+	if pending := grouper.pending(); pending["firing/WEB1"] != 0 {
+		t.Fatalf("pending %v with a firing parent", pending)
+	}
+
+	// Once the parent recovers the still failing child is notified
+	manager.CheckPing(newPingNode("MAIN", "10.0.0.254", true))
+	manager.CheckPing(newPingNode("WEB1", "8.8.8.8", false))
+	if pending := grouper.pending(); pending["firing/WEB1"] != 1 {
+		t.Errorf("pending %v after the parent recovered", pending)
+	}
+}
+
+// A child failing alone is notified after the hold.
+func TestDependencyChildAlone(t *testing.T) {
+	manager := setTestDependencies(t, gatewayRule)
+	grouper := ag
+
+	manager.CheckPing(newPingNode("WEB1", "8.8.8.8", false))
+	if pending := grouper.pending(); len(pending) != 0 {
+		t.Fatalf("pending %v in the hold", pending)
+	}
+
+	manager.mutex.Lock()
+	manager.table["WEB1/ping/8.8.8.8"].StartsAt = time.Now().Add(-time.Minute)
+	manager.mutex.Unlock()
+
+	manager.CheckPing(newPingNode("WEB1", "8.8.8.8", false))
+	if pending := grouper.pending(); pending["firing/WEB1"] != 1 {
+		t.Errorf("pending %v after the hold", pending)
+	}
+}
+
+// Alerts depending on each other are notified, else they mute each other forever.
+func TestDependencyCycle(t *testing.T) {
+	manager := setTestDependencies(t,
+		DependencyRule{Name: "db1", Parent: AlertMatcher{Nodes: []string{"DB1"}}, Children: AlertMatcher{Nodes: []string{"DB2"}}},
+		DependencyRule{Name: "db2", Parent: AlertMatcher{Nodes: []string{"DB2"}}, Children: AlertMatcher{Nodes: []string{"DB1"}}},
+		gatewayRule,
+	)
+	grouper := ag
+
+	gateway := func(name string) *NodeData {
+		node := newPingNode(name, "10.0.0.254", false)
+		node.PingItems = append(node.PingItems, &PingItem{Name: "ping 8.8.8.8", IpAddr: "8.8.8.8"})
+		return node
+	}
+	nodes := []*NodeData{newPingNode("DB1", "8.8.8.8", false), newPingNode("DB2", "8.8.8.8", false), gateway("WEB1"), gateway("WEB2")}
+
+	for _, node := range nodes {
+		manager.CheckPing(node)
+	}
+	manager.mutex.Lock()
+	for _, v := range manager.table {
+		v.StartsAt = time.Now().Add(-time.Hour)
+	}
+	manager.mutex.Unlock()
+	for _, node := range nodes {
+		manager.CheckPing(node)
+	}
+
+	// The gateway pings of both WEB nodes fire, the targets behind it do not
+	pending := grouper.pending()
+	if pending["firing/DB1"] != 1 || pending["firing/DB2"] != 1 || pending["firing/WEB1"] != 1 || pending["firing/WEB2"] != 1 {
+		t.Fatalf("pending %v", pending)
+	}
+	if parent := dp.FindParent(&Alert{Key: "WEB1/ping/8.8.8.8", NodeName: "WEB1", CheckType: CHECK_TYPE_PING, ItemID: "8.8.8.8"}); parent == nil {
+		t.Error("WEB1 target is reachable with its gateway down")
+	}
+	if parent := dp.FindParent(&Alert{Key: "DB1/ping/8.8.8.8", NodeName: "DB1", CheckType: CHECK_TYPE_PING, ItemID: "8.8.8.8"}); parent != nil {
+		t.Errorf("DB1 unreachable by %s", parent.Key)
+	}
+}
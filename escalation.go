@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Escalator notifies the later steps of an escalation policy while an alert
+// stays firing, such as the on-call pager after 10 minutes and the manager after 30.
+// Policies are referenced by "escalation" of web hook routes.
+// Escalations are kept in memory, a restart starts them over from the first step.
+type Escalator struct {
+	mutex    sync.Mutex
+	policies map[string]*EscalationPolicy
+	table    map[string]*Escalation
+}
+
+type EscalationPolicy struct {
+	Name  string           `json:"name"`
+	Steps []EscalationStep `json:"steps"`
+}
+
+type EscalationStep struct {
+	AfterMinutes int      `json:"after_minutes"`
+	Hooks        []string `json:"hooks"`
+}
+
+// Escalation tracks a firing alert through the steps of its policy.
+type Escalation struct {
+	Policy   string      `json:"policy"`
+	Step     int         `json:"step"`
+	Hooks    []string    `json:"hooks"`
+	StartsAt time.Time   `json:"starts_at"`
+	Event    *AlertEvent `json:"event"`
+}
+
+func (self *Escalator) Init() error {
+	self.policies = make(map[string]*EscalationPolicy)
+	self.table = make(map[string]*Escalation)
+
+	if ESCALATION_CONFIG_JSON != "" {
+		b, err := ioutil.ReadFile(ESCALATION_CONFIG_JSON)
+		if err != nil {
+			LogFatal("Can not read %s file (%v).", ESCALATION_CONFIG_JSON, err)
+			return err
+		}
+
+		var policies []*EscalationPolicy
+		if err := json.Unmarshal(b, &policies); err != nil {
+			LogFatal("Error on %s file unmarshal (%v).", ESCALATION_CONFIG_JSON, err)
+			return err
+		}
+
+		for _, v := range policies {
+			// Steps are taken in time order
+			sort.SliceStable(v.Steps, func(i, j int) bool { return v.Steps[i].AfterMinutes < v.Steps[j].AfterMinutes })
+			for _, step := range v.Steps {
+				for _, hook := range step.Hooks {
+					if wh.Item(hook) == nil {
+						err := fmt.Errorf("unknown web hook %s", hook)
+						LogFatal("Error on escalation %s (%v).", v.Name, err)
+						return err
+					}
+				}
+			}
+			self.policies[v.Name] = v
+		}
+	}
+
+	for _, item := range wh.items {
+		for _, route := range item.Routes {
+			if route.Escalation != "" && self.policies[route.Escalation] == nil {
+				err := fmt.Errorf("unknown escalation %s", route.Escalation)
+				LogFatal("Error on web hook %s (%v).", item.Name, err)
+				return err
+			}
+		}
+	}
+
+	LogInfo("Escalator has loaded %d policies.", len(self.policies))
+	return nil
+}
+
+func (self *Escalator) Run() {
+	for RUNNING {
+		self.tick()
+		<-time.After(time.Second * time.Duration(ESCALATION_INTERVAL_SECONDS))
+	}
+}
+
+// Track starts the policy for a firing alert, an alert follows one policy at a time.
+func (self *Escalator) Track(event *AlertEvent, policy string) {
+	if self == nil || event.Kind != ALERT_EVENT_FIRING {
+		return
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if _, ok := self.table[event.Alert.Key]; ok {
+		return
+	}
+
+	LogDebug("Escalation %s started for %s", policy, event.Alert.Key)
+	self.table[event.Alert.Key] = &Escalation{
+		Policy:   policy,
+		StartsAt: event.Alert.StartsAt,
+		Event:    event,
+	}
+}
+
+// Resolve stops the escalation of an alert and tells the escalated hooks.
+func (self *Escalator) Resolve(event *AlertEvent) {
+	esc := self.Stop(event.Alert.Key)
+	if esc == nil {
+		return
+	}
+
+	for _, hook := range esc.Hooks {
+		self.send(hook, event)
+	}
+}
+
+// Stop stops the escalation of an alert without notifying.
+func (self *Escalator) Stop(key string) *Escalation {
+	if self == nil {
+		return nil
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	esc := self.table[key]
+	delete(self.table, key)
+	return esc
+}
+
+func (self *Escalator) tick() {
+	now := time.Now()
+
+	type due struct {
+		hook  string
+		event *AlertEvent
+	}
+	var sends []due
+
+	self.mutex.Lock()
+	for key, esc := range self.table {
+		policy := self.policies[esc.Policy]
+		if reason := am.MuteReason(&esc.Event.Alert); reason != "" {
+			LogDebug("Escalation %s for %s muted by %s", esc.Policy, key, reason)
+			continue
+		}
+
+		for ; esc.Step < len(policy.Steps); esc.Step++ {
+			step := policy.Steps[esc.Step]
+			if now.Before(esc.StartsAt.Add(time.Minute * time.Duration(step.AfterMinutes))) {
+				break
+			}
+
+			LogInfo("Escalation %s step %d for %s", esc.Policy, esc.Step, key)
+			for _, hook := range step.Hooks {
+				if !containsString(esc.Hooks, hook) {
+					esc.Hooks = append(esc.Hooks, hook)
+				}
+				sends = append(sends, due{hook, esc.Event})
+			}
+		}
+	}
+	self.mutex.Unlock()
+
+	for _, v := range sends {
+		self.send(v.hook, v.event)
+	}
+}
+
+func (self *Escalator) send(hook string, event *AlertEvent) {
+	item := wh.Item(hook)
+	if item == nil {
+		return
+	}
+
+	wh.Send(item, event, GetCatalog(item.Language).AlertMessage(event))
+}
+
+func (self *Escalator) Status(c *gin.Context) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	c.JSON(http.StatusOK, self.table)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestEscalator(t *testing.T, nodes ...string) *Escalator {
+	setTestEscalationHooks(t)
+
+	escalator := &Escalator{}
+	escalator.Init()
+	escalator.policies["db"] = &EscalationPolicy{Name: "db", Steps: []EscalationStep{{AfterMinutes: 10, Hooks: []string{"pager"}}}}
+
+	for _, node := range nodes {
+		event := newGroupedEvent(ALERT_EVENT_FIRING, node, "8.8.8.8")
+		event.Alert.StartsAt = time.Now().Add(-time.Hour)
+		escalator.Track(event, "db")
+	}
+	return escalator
+}
+
+// setTestQueuedHooks sets web hooks whose deliveries stay queued, see sent.
+func setTestQueuedHooks(t *testing.T, items ...WebHookItem) {
+	oldWh, oldDq := wh, dq
+	t.Cleanup(func() { wh, dq = oldWh, oldDq })
+
+	wh = &WebHook{isEnabled: true, items: items}
+	dq = &DeliveryQueue{queues: make(map[string]chan *Delivery), stats: make(map[string]*DeliveryStats)}
+	for i := range wh.items {
+		wh.items[i].notifier = newTestNotifier(t, &wh.items[i])
+		dq.queues[wh.items[i].Name] = make(chan *Delivery, 10)
+		dq.stats[wh.items[i].Name] = &DeliveryStats{}
+	}
+}
+
+func setTestEscalationHooks(t *testing.T) {
+	setTestQueuedHooks(t,
+		WebHookItem{Name: "pager", Type: NOTIFIER_TYPE_SLACK, EndPoint: "http://127.0.0.1:1", EscalationOnly: true},
+		WebHookItem{Name: "manager", Type: NOTIFIER_TYPE_SLACK, EndPoint: "http://127.0.0.1:1", EscalationOnly: true},
+	)
+}
+
+// sent takes the keys and kinds of the events queued for hook.
+func sent(hook string) []string {
+	var events []string
+	for {
+		select {
+		case d := <-dq.queues[hook]:
+			events = append(events, d.Event.Kind+" "+d.Event.Alert.Key)
+		default:
+			return events
+		}
+	}
+}
+
+// Escalations wait on the same mutes as notifications.
+func TestEscalationMuted(t *testing.T) {
+	setTestDependencies(t, gatewayRule)
+	DEPENDENCY_HOLD_SECONDS = 0
+
+	oldMw := mw
+	window := &MaintenanceWindow{Schedule: "* * * * *", DurationMinutes: 60, AlertMatcher: AlertMatcher{Nodes: []string{"DB1"}}}
+	if err := window.Init(); err != nil {
+		t.Fatal(err)
+	}
+	mw = &Maintenance{windows: []*MaintenanceWindow{window}}
+	t.Cleanup(func() { mw = oldMw })
+
+	now := time.Now()
+	setTestSilences(t, &Silence{ID: "s", AlertMatcher: AlertMatcher{Nodes: []string{"DB2"}}, StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Hour)})
+
+	am.CheckPing(newPingNode("MAIN", "10.0.0.254", false))
+
+	escalator := newTestEscalator(t, "DB1", "DB2", "WEB1", "DB3")
+	escalator.tick()
+
+	want := map[string]int{"DB1": 0, "DB2": 0, "WEB1": 0, "DB3": 1}
+	for node, step := range want {
+		if esc := escalator.table[node+"/ping/8.8.8.8"]; esc.Step != step {
+			t.Errorf("%s at step %d, want %d", node, esc.Step, step)
+		}
+	}
+}
+
+func TestEscalationSteps(t *testing.T) {
+	setTestDependencies(t)
+	escalator := newTestEscalator(t, "DB1")
+	escalator.policies["db"].Steps = []EscalationStep{
+		{AfterMinutes: 10, Hooks: []string{"pager"}},
+		{AfterMinutes: 30, Hooks: []string{"pager", "manager"}},
+	}
+	esc := escalator.table["DB1/ping/8.8.8.8"]
+
+	tests := []struct {
+		name    string
+		since   time.Duration
+		step    int
+		pager   int
+		manager int
+	}{
+		{"before the first step", 5 * time.Minute, 0, 0, 0},
+		{"first step", 15 * time.Minute, 1, 1, 0},
+		{"first step again", 20 * time.Minute, 1, 0, 0},
+		{"second step", 45 * time.Minute, 2, 1, 1},
+		{"past the last step", 90 * time.Minute, 2, 0, 0},
+	}
+
+	for _, test := range tests {
+		esc.StartsAt = time.Now().Add(-test.since)
+		escalator.tick()
+
+		if esc.Step != test.step {
+			t.Errorf("%s: step %d, want %d", test.name, esc.Step, test.step)
+		}
+		if pager, manager := sent("pager"), sent("manager"); len(pager) != test.pager || len(manager) != test.manager {
+			t.Errorf("%s: pager got %v, manager got %v", test.name, pager, manager)
+		}
+	}
+
+	if len(esc.Hooks) != 2 || esc.Hooks[0] != "pager" || esc.Hooks[1] != "manager" {
+		t.Errorf("escalated hooks %v", esc.Hooks)
+	}
+}
+
+// Steps of a policy are taken by after_minutes, whatever their order in the file.
+func TestEscalationInitSortsSteps(t *testing.T) {
+	setTestDependencies(t)
+	setTestEscalationHooks(t)
+
+	old := ESCALATION_CONFIG_JSON
+	ESCALATION_CONFIG_JSON = filepath.Join(t.TempDir(), "escalations.json")
+	t.Cleanup(func() { ESCALATION_CONFIG_JSON = old })
+
+	config := `[{"name": "db", "steps": [{"after_minutes": 30, "hooks": ["manager"]}, {"after_minutes": 10, "hooks": ["pager"]}]}]`
+	if err := ioutil.WriteFile(ESCALATION_CONFIG_JSON, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	escalator := &Escalator{}
+	if err := escalator.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	event := newGroupedEvent(ALERT_EVENT_FIRING, "DB1", "8.8.8.8")
+	event.Alert.StartsAt = time.Now().Add(-15 * time.Minute)
+	escalator.Track(event, "db")
+	escalator.tick()
+
+	if pager, manager := sent("pager"), sent("manager"); len(pager) != 1 || len(manager) != 0 {
+		t.Errorf("pager got %v, manager got %v", pager, manager)
+	}
+
+	config = `[{"name": "db", "steps": [{"after_minutes": 10, "hooks": ["nobody"]}]}]`
+	if err := ioutil.WriteFile(ESCALATION_CONFIG_JSON, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Escalator{}).Init(); err == nil {
+		t.Error("escalation to an unknown hook loaded")
+	}
+}
+
+// The resolve goes to each escalated hook once, not to hooks of steps not reached.
+func TestEscalationResolve(t *testing.T) {
+	setTestDependencies(t)
+	escalator := newTestEscalator(t, "DB1", "DB2")
+	escalator.policies["db"].Steps = []EscalationStep{
+		{AfterMinutes: 10, Hooks: []string{"pager"}},
+		{AfterMinutes: 30, Hooks: []string{"pager"}},
+		{AfterMinutes: 120, Hooks: []string{"manager"}},
+	}
+	escalator.tick()
+	sent("pager")
+
+	escalator.Resolve(newGroupedEvent(ALERT_EVENT_RESOLVED, "DB1", "8.8.8.8"))
+	if pager, manager := sent("pager"), sent("manager"); len(pager) != 1 || pager[0] != ALERT_EVENT_RESOLVED+" DB1/ping/8.8.8.8" || len(manager) != 0 {
+		t.Errorf("pager got %v, manager got %v", pager, manager)
+	}
+	if _, ok := escalator.table["DB1/ping/8.8.8.8"]; ok {
+		t.Error("DB1 still escalating")
+	}
+
+	// Resolving an alert without escalation tells nobody
+	escalator.Resolve(newGroupedEvent(ALERT_EVENT_RESOLVED, "DB3", "8.8.8.8"))
+	if pager := sent("pager"); len(pager) != 0 {
+		t.Errorf("pager got %v", pager)
+	}
+	if _, ok := escalator.table["DB2/ping/8.8.8.8"]; !ok {
+		t.Error("DB2 stopped escalating")
+	}
+}
+
+// Acknowledged or resolved incidents stop their escalation without notifying.
+func TestEscalationStoppedByIncident(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, action := range []string{"ack", "resolve"} {
+		t.Run(action, func(t *testing.T) {
+			setTestDependencies(t)
+			escalator := newTestEscalator(t, "DB1")
+
+			oldEs, oldInc := es, inc
+			es, inc = escalator, newTestIncidents(t)
+			t.Cleanup(func() { es, inc = oldEs, oldInc })
+
+			id := inc.Open(&escalator.table["DB1/ping/8.8.8.8"].Event.Alert)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Params = gin.Params{{Key: "id", Value: id}}
+			c.Request = httptest.NewRequest(http.MethodPost, "/incidents/"+id+"/"+action, strings.NewReader(`{"by": "ops"}`))
+			if action == "ack" {
+				inc.Ack(c)
+			} else {
+				inc.Resolve(c)
+			}
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d (%s)", w.Code, w.Body.String())
+			}
+
+			if len(escalator.table) != 0 {
+				t.Fatalf("escalations %v", escalator.table)
+			}
+			// Its steps were due, the pager is not called after all
+			escalator.tick()
+			if pager := sent("pager"); len(pager) != 0 {
+				t.Errorf("pager got %v", pager)
+			}
+		})
+	}
+}
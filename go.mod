@@ -9,5 +9,6 @@ require (
 	github.com/minio/minio v0.0.0-20201020162327-6fd088f448d4
 	github.com/stretchr/objx v0.1.1 // indirect
 	github.com/tatsushid/go-fastping v0.0.0-20160109021039-d7bb493dee3e
+	golang.org/x/net v0.0.0-20200904194848-62affa334b73
 	gopkg.in/ini.v1 v1.62.0
 )
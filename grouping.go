@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	GROUP_BY_NODE       = "node"
+	GROUP_BY_CHECK_TYPE = "check_type"
+	GROUP_BY_SEVERITY   = "severity"
+	GROUP_BY_LABEL      = "label:"
+)
+
+// AlertGrouper holds alert events for a window and notifies them together,
+// events of different kinds or group keys never share a notification.
+// A firing and a resolved of one alert in the same window cancel out,
+// so a flap is never notified as a resolve without or before its firing.
+type AlertGrouper struct {
+	mutex  sync.Mutex
+	groups map[string][]*AlertEvent
+	timers map[string]*time.Timer
+}
+
+func (self *AlertGrouper) Init() {
+	self.groups = make(map[string][]*AlertEvent)
+	self.timers = make(map[string]*time.Timer)
+}
+
+func (self *AlertGrouper) Add(event *AlertEvent) {
+	key := self.groupKey(event)
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.cancel(event) {
+		LogDebug("Alert %s %s cancelled a pending event", event.Alert.Key, event.Kind)
+		return
+	}
+
+	if _, ok := self.groups[key]; !ok {
+		self.timers[key] = time.AfterFunc(time.Second*time.Duration(GROUP_WINDOW_SECONDS), func() {
+			self.flush(key)
+		})
+	}
+	self.groups[key] = append(self.groups[key], event)
+}
+
+// cancel removes a pending event of the opposite kind of the same alert,
+// it must be called with the mutex held.
+func (self *AlertGrouper) cancel(event *AlertEvent) bool {
+	var opposite string
+	switch event.Kind {
+	case ALERT_EVENT_FIRING:
+		opposite = ALERT_EVENT_RESOLVED
+	case ALERT_EVENT_RESOLVED:
+		opposite = ALERT_EVENT_FIRING
+	default:
+		return false
+	}
+
+	for key, events := range self.groups {
+		for i, v := range events {
+			if v.Kind != opposite || v.Alert.Key != event.Alert.Key {
+				continue
+			}
+
+			events = append(events[:i:i], events[i+1:]...)
+			if len(events) == 0 {
+				self.timers[key].Stop()
+				delete(self.timers, key)
+				delete(self.groups, key)
+			} else {
+				self.groups[key] = events
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func (self *AlertGrouper) flush(key string) {
+	self.mutex.Lock()
+	events := self.groups[key]
+	delete(self.groups, key)
+	delete(self.timers, key)
+	self.mutex.Unlock()
+
+	if len(events) == 0 || wh == nil {
+		return
+	}
+
+	LogDebug("Alert group %s flushed %d alerts", key, len(events))
+	if len(events) == 1 {
+		wh.Notify(events[0])
+	} else {
+		wh.Notify(NewGroupEvent(events))
+	}
+}
+
+func (self *AlertGrouper) groupKey(event *AlertEvent) string {
+	parts := []string{event.Kind}
+	for _, v := range GROUP_BY {
+		switch {
+		case v == GROUP_BY_NODE:
+			parts = append(parts, event.Alert.NodeName)
+		case v == GROUP_BY_CHECK_TYPE:
+			parts = append(parts, event.Alert.CheckType)
+		case v == GROUP_BY_SEVERITY:
+			parts = append(parts, event.Alert.Severity)
+		case strings.HasPrefix(v, GROUP_BY_LABEL):
+			parts = append(parts, event.Alert.Labels[strings.TrimPrefix(v, GROUP_BY_LABEL)])
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// NewGroupEvent combines events of one kind into an event whose alert
+// keeps what the members have in common.
+func NewGroupEvent(events []*AlertEvent) *AlertEvent {
+	first := events[0]
+	group := &AlertEvent{
+		Kind:     first.Kind,
+		OldState: first.OldState,
+		NewState: first.NewState,
+		Time:     first.Time,
+		Alert: Alert{
+			NodeName:   first.Alert.NodeName,
+			NodeIpAddr: first.Alert.NodeIpAddr,
+			CheckType:  first.Alert.CheckType,
+			Severity:   first.Alert.Severity,
+			State:      first.Alert.State,
+			StartsAt:   first.Alert.StartsAt,
+			EndsAt:     first.Alert.EndsAt,
+			Labels:     make(map[string]string),
+		},
+		Group: events,
+	}
+
+	var keys []string
+	for k, v := range first.Alert.Labels {
+		group.Alert.Labels[k] = v
+	}
+
+	for _, v := range events {
+		keys = append(keys, v.Alert.Key)
+
+		if v.Alert.NodeName != group.Alert.NodeName {
+			group.Alert.NodeName = ""
+			group.Alert.NodeIpAddr = ""
+		}
+		if v.Alert.CheckType != group.Alert.CheckType {
+			group.Alert.CheckType = ""
+		}
+		if v.Alert.Severity == SEVERITY_CRITICAL {
+			group.Alert.Severity = SEVERITY_CRITICAL
+		}
+		if v.Alert.StartsAt.Before(group.Alert.StartsAt) {
+			group.Alert.StartsAt = v.Alert.StartsAt
+		}
+		if v.Alert.EndsAt.After(group.Alert.EndsAt) {
+			group.Alert.EndsAt = v.Alert.EndsAt
+		}
+		for k, x := range group.Alert.Labels {
+			if v.Alert.Labels[k] != x {
+				delete(group.Alert.Labels, k)
+			}
+		}
+	}
+
+	sort.Strings(keys)
+	group.Alert.Key = "group/" + strings.Join(keys, ",")
+	group.Alert.ItemName = fmt.Sprintf("%d", len(events))
+	return group
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+)
+
+func newGroupedEvent(kind, node, item string) *AlertEvent {
+	return &AlertEvent{
+		Kind: kind,
+		Alert: Alert{
+			Key:       node + "/" + CHECK_TYPE_PING + "/" + item,
+			NodeName:  node,
+			CheckType: CHECK_TYPE_PING,
+			ItemID:    item,
+		},
+	}
+}
+
+func newTestGrouper(t *testing.T) *AlertGrouper {
+	window, by := GROUP_WINDOW_SECONDS, GROUP_BY
+	GROUP_WINDOW_SECONDS, GROUP_BY = 3600, []string{GROUP_BY_NODE}
+
+	grouper := &AlertGrouper{}
+	grouper.Init()
+	t.Cleanup(func() {
+		for _, v := range grouper.timers {
+			v.Stop()
+		}
+		GROUP_WINDOW_SECONDS, GROUP_BY = window, by
+	})
+	return grouper
+}
+
+func (self *AlertGrouper) pending() map[string]int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	counts := make(map[string]int)
+	for key, events := range self.groups {
+		counts[key] = len(events)
+	}
+	return counts
+}
+
+func TestAlertGrouperGroups(t *testing.T) {
+	grouper := newTestGrouper(t)
+	grouper.Add(newGroupedEvent(ALERT_EVENT_FIRING, "A", "1"))
+	grouper.Add(newGroupedEvent(ALERT_EVENT_FIRING, "A", "2"))
+	grouper.Add(newGroupedEvent(ALERT_EVENT_FIRING, "B", "1"))
+	grouper.Add(newGroupedEvent(ALERT_EVENT_RESOLVED, "B", "2"))
+
+	pending := grouper.pending()
+	if len(pending) != 3 || pending["firing/A"] != 2 || pending["firing/B"] != 1 || pending["resolved/B"] != 1 {
+		t.Errorf("pending %v", pending)
+	}
+	if len(grouper.timers) != 3 {
+		t.Errorf("%d timers", len(grouper.timers))
+	}
+}
+
+// A flap within the window notifies neither the firing nor the resolved.
+func TestAlertGrouperCancelsFlap(t *testing.T) {
+	grouper := newTestGrouper(t)
+	grouper.Add(newGroupedEvent(ALERT_EVENT_FIRING, "A", "1"))
+	grouper.Add(newGroupedEvent(ALERT_EVENT_FIRING, "A", "2"))
+	grouper.Add(newGroupedEvent(ALERT_EVENT_RESOLVED, "A", "1"))
+
+	pending := grouper.pending()
+	if len(pending) != 1 || pending["firing/A"] != 1 || grouper.groups["firing/A"][0].Alert.ItemID != "2" {
+		t.Errorf("pending %v", pending)
+	}
+
+	grouper.Add(newGroupedEvent(ALERT_EVENT_RESOLVED, "A", "2"))
+	if pending := grouper.pending(); len(pending) != 0 || len(grouper.timers) != 0 {
+		t.Errorf("pending %v, %d timers", pending, len(grouper.timers))
+	}
+
+	// A resolved then a firing again keeps the alert firing without notifying
+	grouper.Add(newGroupedEvent(ALERT_EVENT_RESOLVED, "A", "3"))
+	grouper.Add(newGroupedEvent(ALERT_EVENT_FIRING, "A", "3"))
+	if pending := grouper.pending(); len(pending) != 0 {
+		t.Errorf("pending %v", pending)
+	}
+
+	// Reminders are never cancelled
+	grouper.Add(newGroupedEvent(ALERT_EVENT_REMINDER, "A", "4"))
+	grouper.Add(newGroupedEvent(ALERT_EVENT_RESOLVED, "A", "4"))
+	if pending := grouper.pending(); pending["reminder/A"] != 1 || pending["resolved/A"] != 1 {
+		t.Errorf("pending %v", pending)
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"github.com/gin-gonic/gin"
 	"io/ioutil"
 	"net/http"
+	"sync"
 	"time"
 )
 
 type Heartbeat struct {
+	mutex sync.Mutex
 	items []*HeartbeatItem
 	table map[string]*HeartbeatItem
 }
@@ -19,6 +21,7 @@ type HeartbeatItem struct {
 	LastCheckTime int64  `json:"last_check_time_seconds"`
 	LastCheck     string `json:"last_check_time"`
 	IsOnline      bool   `json:"is_online"`
+	CheckState
 }
 
 type HeartbeatJsonItem struct {
@@ -53,33 +56,46 @@ func (self *Heartbeat) Run() {
 		self.table[v.ID] = hbi
 	}
 
+	threshold := NewThreshold(HB_FAIL_AFTER, HB_RECOVER_AFTER, HB_FLAP_WINDOW, HB_FLAP_CHANGES)
+
 	LogInfo("Heartbeat checker has loaded %d apps.", len(self.items))
 	<-time.After(time.Second * time.Duration(HB_INTERVAL_SECONDS))
 
 	for RUNNING {
-		for _, v := range self.items {
-			now := time.Now().Unix()
-
-			if now-v.LastCheckTime > HB_TIMEOUT_SECONDS {
-				LogDebug("Heartbeat check fail on %s (%s), %s", v.Name, v.ID, v.LastCheck)
-				v.IsOnline = false
-			} else {
-				LogDebug("Heartbeat check success on %s (%s), %s", v.Name, v.ID, v.LastCheck)
-				v.IsOnline = true
-			}
-		}
-
-		go ctr.ProcessHeartbeat(NodeData{
-			Name:           NODE_NAME,
-			IpAddr:         LOCAL_IPADDR,
-			HeartbeatItems: self.items,
-		})
+		data := self.check(threshold)
+		go ctr.ProcessHeartbeat(data)
 
 		LogDebug("Wait next heartbeat check %ds", HB_INTERVAL_SECONDS)
 		<-time.After(time.Second * time.Duration(HB_INTERVAL_SECONDS))
 	}
 }
 
+// check observes the items against their last pings and returns a copy to report.
+func (self *Heartbeat) check(threshold *Threshold) NodeData {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for _, v := range self.items {
+		now := time.Now().Unix()
+
+		if now-v.LastCheckTime > HB_TIMEOUT_SECONDS {
+			LogDebug("Heartbeat check fail on %s (%s), %s", v.Name, v.ID, v.LastCheck)
+			v.IsOnline = v.Observe(false, v.IsOnline, threshold)
+		} else {
+			LogDebug("Heartbeat check success on %s (%s), %s", v.Name, v.ID, v.LastCheck)
+			v.IsOnline = v.Observe(true, v.IsOnline, threshold)
+		}
+	}
+
+	data := NodeData{
+		Name:           NODE_NAME,
+		IpAddr:         LOCAL_IPADDR,
+		HeartbeatItems: self.items,
+	}
+	rm.Check(&data)
+	return data.Copy()
+}
+
 func (self *Heartbeat) Ping(c *gin.Context) {
 	id := c.Param("id")
 	if id != "" {
@@ -88,11 +104,14 @@ func (self *Heartbeat) Ping(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"message": "No matching watching app."})
 		} else {
 			now := time.Now()
+			self.mutex.Lock()
 			item.LastCheckTime = now.Unix()
 			item.LastCheck = time.Unix(0, now.UnixNano()).String()
+			data := *item
+			self.mutex.Unlock()
 
-			c.JSON(http.StatusOK, item)
-			LogDebug("Heartbeat ping on %s (%s), %s", item.Name, item.ID, item.LastCheck)
+			c.JSON(http.StatusOK, &data)
+			LogDebug("Heartbeat ping on %s (%s), %s", data.Name, data.ID, data.LastCheck)
 		}
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "No id."})
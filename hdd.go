@@ -21,6 +21,7 @@ type HDDItem struct {
 	Used          string  `json:"used"`
 	Free          string  `json:"free"`
 	IsWarning     bool    `json:"is_warning"`
+	CheckState
 }
 
 func (self *HDD) Run() {
@@ -34,10 +35,12 @@ func (self *HDD) Run() {
 		})
 	}
 
+	threshold := NewThreshold(HDD_FAIL_AFTER, HDD_RECOVER_AFTER, HDD_FLAP_WINDOW, HDD_FLAP_CHANGES)
+
 	// Loop
 	for RUNNING {
 		for _, v := range self.items {
-			self.check(v)
+			self.check(v, threshold)
 
 			now := time.Now()
 			v.LastCheckTime = now.Unix()
@@ -49,9 +52,11 @@ func (self *HDD) Run() {
 			IpAddr:   LOCAL_IPADDR,
 			HddItems: self.items,
 		}
+		rm.Check(&data)
+		data = data.Copy()
 
 		if !IS_MASTER {
-			go Post(parentNodeUrl, nil, "json", data)
+			go PostWithOptions(parentNodeUrl, nil, "json", data, masterLink)
 		} else {
 			go ctr.ProcessHdd(data)
 		}
@@ -61,7 +66,7 @@ func (self *HDD) Run() {
 	}
 }
 
-func (self *HDD) check(item *HDDItem) error {
+func (self *HDD) check(item *HDDItem, threshold *Threshold) error {
 	di, err := disk.GetInfo(item.Path)
 	if err != nil {
 		return err
@@ -75,9 +80,9 @@ func (self *HDD) check(item *HDDItem) error {
 	item.Free = humanize.Bytes(di.Free)
 
 	if percentage > float64(HDD_LIMIT_PERCENT) {
-		item.IsWarning = true
+		item.IsWarning = !item.Observe(false, !item.IsWarning, threshold)
 	} else {
-		item.IsWarning = false
+		item.IsWarning = !item.Observe(true, !item.IsWarning, threshold)
 	}
 
 	LogDebug("%s (%s) is %s of %s disk space used (%0.2f%%)",
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const DEFAULT_LANGUAGE = "en"
+
+type Locale struct {
+	DecimalSeparator  string `json:"decimal_separator"`
+	ThousandSeparator string `json:"thousand_separator"`
+	DateLayout        string `json:"date_layout"`
+}
+
+type CatalogFile struct {
+	Locale   *Locale           `json:"locale"`
+	Messages map[string]string `json:"messages"`
+}
+
+type Catalog struct {
+	Language string
+	Locale   Locale
+	Messages map[string]string
+
+	templates map[string]*template.Template
+}
+
+var catalogs map[string]*Catalog
+
+var builtinCatalogs = map[string]*CatalogFile{
+	"en": {
+		Locale: &Locale{
+			DecimalSeparator:  ".",
+			ThousandSeparator: ",",
+			DateLayout:        "Jan 2, 2006 15:04:05 MST",
+		},
+		Messages: map[string]string{
+			"heartbeat.firing": "[{{.Node.Name}}/{{.Node.IpAddr}}] {{.ItemName}} ({{.ItemID}}) Heartbeat down\n\n" +
+				"- Last alive time\n{{date .Item.LastCheckTime}}",
+			"ping.firing": "[{{.Node.Name}}/{{.Node.IpAddr}}] {{.ItemName}} ({{.ItemID}}) Ping down\n\n" +
+				"- Last check time\n{{date .Item.LastCheckTime}}\n" +
+				"- Last RTT\n{{number .Item.LastRTT 0}}ms" +
+				"{{with .Item.Trace}}\n- Trace route ({{date .StartTime}})" +
+				"{{range .Hops}}\n{{.TTL}}. {{if .Recv}}{{.IpAddr}} {{number .AvgRTT 1}}ms loss {{number .Loss 0}}%{{else}}*{{end}}{{end}}" +
+				"{{if .Error}}\n{{.Error}}{{end}}{{end}}",
+			"hdd.firing": "[{{.Node.Name}}/{{.Node.IpAddr}}] {{.ItemName}} ({{.ItemID}}) Disk usage warning\n\n" +
+				"- Last check time\n{{date .Item.LastCheckTime}}\n" +
+				"- Usage\n{{number .Item.Usage 2}}%\n" +
+				"- Total\n{{.Item.Total}}\n" +
+				"- Used\n{{.Item.Used}}\n" +
+				"- Free\n{{.Item.Free}}",
+			"heartbeat.resolved": "[{{.Node.Name}}/{{.Node.IpAddr}}] {{.ItemName}} ({{.ItemID}}) Heartbeat recovered\n\n" +
+				"- Down since\n{{date .StartsAt}}\n- Recovered at\n{{date .EndsAt}}",
+			"ping.resolved": "[{{.Node.Name}}/{{.Node.IpAddr}}] {{.ItemName}} ({{.ItemID}}) Ping recovered\n\n" +
+				"- Down since\n{{date .StartsAt}}\n- Recovered at\n{{date .EndsAt}}",
+			"hdd.resolved": "[{{.Node.Name}}/{{.Node.IpAddr}}] {{.ItemName}} ({{.ItemID}}) Disk usage recovered\n\n" +
+				"- Warning since\n{{date .StartsAt}}\n- Recovered at\n{{date .EndsAt}}\n- Usage\n{{number .Item.Usage 2}}%",
+			"reminder": "\n- Still firing since\n{{date .StartsAt}}",
+			"remediation": "\n- Remediation{{range .Remediations}}\n{{.Action}} attempt {{.Attempt}} {{.Result}}" +
+				"{{if .Error}} ({{.Error}}){{end}}{{end}}",
+			"remediation.result": "{{.Action}} attempt {{.Attempt}} {{.Result}}{{if .Error}} ({{.Error}}){{end}}",
+			"title": "{{if eq .Kind \"report\"}}{{.ItemName}}{{else}}" +
+				"{{if eq .Kind \"resolved\"}}[RESOLVED]{{else if eq .Kind \"reminder\"}}[STILL FIRING]" +
+				"{{else if eq .Kind \"suppressed\"}}[SUPPRESSED]{{else}}[FIRING]{{end}} " +
+				"{{if .Group}}{{len .Group}} alerts{{else}}{{.ItemName}} {{.CheckType}}{{end}} on {{with .Node.Name}}{{.}}{{else}}*{{end}}{{end}}",
+			"group.firing": "[{{with .Node.Name}}{{.}}{{else}}*{{end}}] {{len .Group}} alerts firing" +
+				"{{range .Group}}\n- {{.Node.Name}} {{.ItemName}} ({{.ItemID}}) {{.CheckType}}, since {{date .StartsAt}}{{end}}",
+			"group.reminder": "[{{with .Node.Name}}{{.}}{{else}}*{{end}}] {{len .Group}} alerts still firing" +
+				"{{range .Group}}\n- {{.Node.Name}} {{.ItemName}} ({{.ItemID}}) {{.CheckType}}, since {{date .StartsAt}}{{end}}",
+			"group.resolved": "[{{with .Node.Name}}{{.}}{{else}}*{{end}}] {{len .Group}} alerts recovered" +
+				"{{range .Group}}\n- {{.Node.Name}} {{.ItemName}} ({{.ItemID}}) {{.CheckType}}, recovered at {{date .EndsAt}}{{end}}",
+			"group.suppressed": "{{len .Group}} more alerts suppressed by the rate limit" +
+				"{{range .Group}}\n- [{{.Kind}}] {{.Node.Name}} {{.ItemName}} ({{.ItemID}}) {{.CheckType}}, {{date .Time}}{{end}}",
+			"field.node":        "Node",
+			"field.item":        "Item",
+			"field.check_type":  "Check",
+			"field.severity":    "Severity",
+			"field.last_check":  "Last check",
+			"field.rtt":         "RTT",
+			"field.usage":       "Usage",
+			"field.free":        "Free / Total",
+			"field.count":       "Alerts",
+			"field.period":      "Period",
+			"field.remediation": "Remediation",
+			"report.daily":      "Daily report",
+			"report.weekly":     "Weekly report",
+			"report.body": "{{.Title}}\n{{date .Since}} ~ {{date .Until}}\n\n" +
+				"[Uptime]{{range .Uptime}}\n- {{.Node}} {{.Item}} {{.CheckType}}: {{number .Percent 2}}%{{else}}\n- none{{end}}\n\n" +
+				"[Incidents] {{len .Incidents}}{{range .Incidents}}\n- {{.NodeName}} {{.ItemName}} {{.CheckType}}: " +
+				"{{date .StartsAt}} ~ {{date .EndsAt}} ({{.State}}){{end}}\n\n" +
+				"[Slowest ping]{{range .SlowestPings}}\n- {{.Node}} {{.Item}}: avg {{number .AvgRTT 1}}ms, max {{number .MaxRTT 0}}ms{{else}}\n- none{{end}}\n\n" +
+				"[Fullest disk]{{range .FullestDisks}}\n- {{.Node}} {{.Item}}: {{number .Usage 2}}% ({{.Free}} / {{.Total}}){{else}}\n- none{{end}}\n\n" +
+				"[Flapping]{{range .Flapping}}\n- {{.Node}} {{.Item}} {{.CheckType}}{{else}}\n- none{{end}}",
+		},
+	},
+	"ko": {
+		Locale: &Locale{
+			DecimalSeparator:  ".",
+			ThousandSeparator: ",",
+			DateLayout:        "2006년 1월 2일 15:04:05 MST",
+		},
+		Messages: map[string]string{
+			"heartbeat.firing": "[{{.Node.Name}}/{{.Node.IpAddr}}] {{.ItemName}} ({{.ItemID}}) Heartbeat 다운 경고\n\n" +
+				"- 마지막 동작 시간\n{{date .Item.LastCheckTime}}",
+			"ping.firing": "[{{.Node.Name}}/{{.Node.IpAddr}}] {{.ItemName}} ({{.ItemID}}) Ping 다운 경고\n\n" +
+				"- 마지막 확인 시간\n{{date .Item.LastCheckTime}}\n" +
+				"- 마지막 RTT\n{{number .Item.LastRTT 0}}ms" +
+				"{{with .Item.Trace}}\n- 경로 추적 ({{date .StartTime}})" +
+				"{{range .Hops}}\n{{.TTL}}. {{if .Recv}}{{.IpAddr}} {{number .AvgRTT 1}}ms 손실 {{number .Loss 0}}%{{else}}*{{end}}{{end}}" +
+				"{{if .Error}}\n{{.Error}}{{end}}{{end}}",
+			"hdd.firing": "[{{.Node.Name}}/{{.Node.IpAddr}}] {{.ItemName}} ({{.ItemID}}) Disk 사용량 경고\n\n" +
+				"- 마지막 확인 시간\n{{date .Item.LastCheckTime}}\n" +
+				"- 사용율\n{{number .Item.Usage 2}}%\n" +
+				"- 총 공간\n{{.Item.Total}}\n" +
+				"- 사용중인 공간\n{{.Item.Used}}\n" +
+				"- 잔여 공간\n{{.Item.Free}}",
+			"heartbeat.resolved": "[{{.Node.Name}}/{{.Node.IpAddr}}] {{.ItemName}} ({{.ItemID}}) Heartbeat 복구\n\n" +
+				"- 발생 시간\n{{date .StartsAt}}\n- 복구 시간\n{{date .EndsAt}}",
+			"ping.resolved": "[{{.Node.Name}}/{{.Node.IpAddr}}] {{.ItemName}} ({{.ItemID}}) Ping 복구\n\n" +
+				"- 발생 시간\n{{date .StartsAt}}\n- 복구 시간\n{{date .EndsAt}}",
+			"hdd.resolved": "[{{.Node.Name}}/{{.Node.IpAddr}}] {{.ItemName}} ({{.ItemID}}) Disk 사용량 복구\n\n" +
+				"- 발생 시간\n{{date .StartsAt}}\n- 복구 시간\n{{date .EndsAt}}\n- 사용율\n{{number .Item.Usage 2}}%",
+			"reminder": "\n- 최초 발생 시간\n{{date .StartsAt}}",
+			"remediation": "\n- 자동 조치{{range .Remediations}}\n{{.Action}} {{.Attempt}}회차 " +
+				"{{if eq .Result \"succeeded\"}}성공{{else if eq .Result \"failed\"}}실패{{else}}진행 중{{end}}" +
+				"{{if .Error}} ({{.Error}}){{end}}{{end}}",
+			"remediation.result": "{{.Action}} {{.Attempt}}회차 " +
+				"{{if eq .Result \"succeeded\"}}성공{{else if eq .Result \"failed\"}}실패{{else}}진행 중{{end}}" +
+				"{{if .Error}} ({{.Error}}){{end}}",
+			"title": "{{if eq .Kind \"report\"}}{{.ItemName}}{{else}}" +
+				"{{if eq .Kind \"resolved\"}}[복구]{{else if eq .Kind \"reminder\"}}[지속]" +
+				"{{else if eq .Kind \"suppressed\"}}[보류]{{else}}[발생]{{end}} " +
+				"{{with .Node.Name}}{{.}}{{else}}*{{end}} {{if .Group}}{{len .Group}}건{{else}}{{.ItemName}} {{.CheckType}}{{end}}{{end}}",
+			"group.firing": "[{{with .Node.Name}}{{.}}{{else}}*{{end}}] {{len .Group}}건 다운 경고" +
+				"{{range .Group}}\n- {{.Node.Name}} {{.ItemName}} ({{.ItemID}}) {{.CheckType}}, 발생 {{date .StartsAt}}{{end}}",
+			"group.reminder": "[{{with .Node.Name}}{{.}}{{else}}*{{end}}] {{len .Group}}건 다운 지속" +
+				"{{range .Group}}\n- {{.Node.Name}} {{.ItemName}} ({{.ItemID}}) {{.CheckType}}, 발생 {{date .StartsAt}}{{end}}",
+			"group.resolved": "[{{with .Node.Name}}{{.}}{{else}}*{{end}}] {{len .Group}}건 복구" +
+				"{{range .Group}}\n- {{.Node.Name}} {{.ItemName}} ({{.ItemID}}) {{.CheckType}}, 복구 {{date .EndsAt}}{{end}}",
+			"group.suppressed": "전송 제한으로 보류된 알림 {{len .Group}}건" +
+				"{{range .Group}}\n- [{{.Kind}}] {{.Node.Name}} {{.ItemName}} ({{.ItemID}}) {{.CheckType}}, {{date .Time}}{{end}}",
+			"field.node":        "노드",
+			"field.item":        "항목",
+			"field.check_type":  "검사",
+			"field.severity":    "심각도",
+			"field.last_check":  "마지막 확인",
+			"field.rtt":         "RTT",
+			"field.usage":       "사용율",
+			"field.free":        "잔여 / 총 공간",
+			"field.count":       "알림 수",
+			"field.period":      "기간",
+			"field.remediation": "자동 조치",
+			"report.daily":      "일간 보고서",
+			"report.weekly":     "주간 보고서",
+			"report.body": "{{.Title}}\n{{date .Since}} ~ {{date .Until}}\n\n" +
+				"[가동률]{{range .Uptime}}\n- {{.Node}} {{.Item}} {{.CheckType}}: {{number .Percent 2}}%{{else}}\n- 없음{{end}}\n\n" +
+				"[장애] {{len .Incidents}}건{{range .Incidents}}\n- {{.NodeName}} {{.ItemName}} {{.CheckType}}: " +
+				"{{date .StartsAt}} ~ {{date .EndsAt}} ({{.State}}){{end}}\n\n" +
+				"[느린 Ping]{{range .SlowestPings}}\n- {{.Node}} {{.Item}}: 평균 {{number .AvgRTT 1}}ms, 최대 {{number .MaxRTT 0}}ms{{else}}\n- 없음{{end}}\n\n" +
+				"[Disk 사용율]{{range .FullestDisks}}\n- {{.Node}} {{.Item}}: {{number .Usage 2}}% ({{.Free}} / {{.Total}}){{else}}\n- 없음{{end}}\n\n" +
+				"[상태 반복 변경]{{range .Flapping}}\n- {{.Node}} {{.Item}} {{.CheckType}}{{else}}\n- 없음{{end}}",
+		},
+	},
+}
+
+// LoadCatalogs builds the built-in catalogs and merges <language>.json files of path over them.
+// Missing messages fall back to English.
+func LoadCatalogs(path string) error {
+	files := make(map[string]*CatalogFile)
+	for k, v := range builtinCatalogs {
+		files[k] = v
+	}
+
+	if path != "" {
+		matches, err := filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return err
+		}
+
+		for _, v := range matches {
+			b, err := ioutil.ReadFile(v)
+			if err != nil {
+				LogFatal("Can not read %s file (%v).", v, err)
+				return err
+			}
+
+			var file CatalogFile
+			if err := json.Unmarshal(b, &file); err != nil {
+				LogFatal("Error on %s file unmarshal (%v).", v, err)
+				return err
+			}
+
+			language := strings.TrimSuffix(filepath.Base(v), ".json")
+			files[language] = mergeCatalogFile(files[language], &file)
+		}
+	}
+
+	catalogs = make(map[string]*Catalog)
+	for language, file := range files {
+		catalog := &Catalog{
+			Language: language,
+			Locale:   *builtinCatalogs[DEFAULT_LANGUAGE].Locale,
+			Messages: make(map[string]string),
+		}
+		if file.Locale != nil {
+			catalog.Locale = *file.Locale
+		}
+		for k, v := range builtinCatalogs[DEFAULT_LANGUAGE].Messages {
+			catalog.Messages[k] = v
+		}
+		for k, v := range file.Messages {
+			catalog.Messages[k] = v
+		}
+
+		if err := catalog.compile(); err != nil {
+			LogFatal("Error on %s message catalog (%v).", language, err)
+			return err
+		}
+		catalogs[language] = catalog
+	}
+
+	LogInfo("Message catalogs have loaded %d languages.", len(catalogs))
+	return nil
+}
+
+func mergeCatalogFile(base *CatalogFile, file *CatalogFile) *CatalogFile {
+	if base == nil {
+		return file
+	}
+
+	merged := &CatalogFile{
+		Locale:   base.Locale,
+		Messages: make(map[string]string),
+	}
+	if file.Locale != nil {
+		merged.Locale = file.Locale
+	}
+	for k, v := range base.Messages {
+		merged.Messages[k] = v
+	}
+	for k, v := range file.Messages {
+		merged.Messages[k] = v
+	}
+	return merged
+}
+
+// GetCatalog returns the catalog of language, or of LOCALE_LANGUAGE when it is empty or unknown.
+func GetCatalog(language string) *Catalog {
+	if catalog := catalogs[language]; catalog != nil {
+		return catalog
+	}
+	if catalog := catalogs[LOCALE_LANGUAGE]; catalog != nil {
+		return catalog
+	}
+	return catalogs[DEFAULT_LANGUAGE]
+}
+
+func (self *Catalog) compile() error {
+	funcs := template.FuncMap{
+		"number": self.FormatNumber,
+		"date":   self.FormatDate,
+	}
+
+	self.templates = make(map[string]*template.Template)
+	for k, v := range self.Messages {
+		t, err := template.New(k).Funcs(templateFuncs).Funcs(funcs).Parse(v)
+		if err != nil {
+			return err
+		}
+		self.templates[k] = t
+	}
+	return nil
+}
+
+func (self *Catalog) Message(key string, data interface{}) string {
+	t := self.templates[key]
+	if t == nil {
+		return key
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		LogFatal("Message %s of %s failed (%v).", key, self.Language, err)
+		return key
+	}
+	return buf.String()
+}
+
+func (self *Catalog) AlertMessage(event *AlertEvent) string {
+	data := NewTemplateEvent(event, "")
+
+	if len(event.Group) > 0 {
+		return self.Message("group."+event.Kind, data)
+	}
+
+	var message string
+	switch event.Kind {
+	case ALERT_EVENT_RESOLVED:
+		message = self.Message(event.Alert.CheckType+".resolved", data)
+	case ALERT_EVENT_REMINDER:
+		message = self.Message(event.Alert.CheckType+".firing", data) + self.Message("reminder", data)
+	default:
+		message = self.Message(event.Alert.CheckType+".firing", data)
+	}
+
+	if len(event.Alert.Remediations) > 0 {
+		message += self.Message("remediation", data)
+	}
+	return message
+}
+
+func (self *Catalog) FormatNumber(v interface{}, decimals int) string {
+	var f float64
+	switch v := v.(type) {
+	case int:
+		f = float64(v)
+	case int64:
+		f = float64(v)
+	case float64:
+		f = v
+	case float32:
+		f = float64(v)
+	default:
+		return fmt.Sprint(v)
+	}
+
+	s := strconv.FormatFloat(math.Abs(f), 'f', decimals, 64)
+	integer, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		integer, fraction = s[:i], s[i+1:]
+	}
+
+	var sb strings.Builder
+	if f < 0 {
+		sb.WriteString("-")
+	}
+	for i, c := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			sb.WriteString(self.Locale.ThousandSeparator)
+		}
+		sb.WriteRune(c)
+	}
+	if fraction != "" {
+		sb.WriteString(self.Locale.DecimalSeparator)
+		sb.WriteString(fraction)
+	}
+	return sb.String()
+}
+
+// FormatDate formats a time.Time or unix seconds, zero is "-".
+func (self *Catalog) FormatDate(v interface{}) string {
+	var t time.Time
+	switch v := v.(type) {
+	case time.Time:
+		t = v
+	case int64:
+		if v != 0 {
+			t = time.Unix(v, 0)
+		}
+	default:
+		return fmt.Sprint(v)
+	}
+
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(self.Locale.DateLayout)
+}
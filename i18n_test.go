@@ -0,0 +1,119 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loadTestCatalogs(t *testing.T, files map[string]string) {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { LoadCatalogs("") })
+
+	if err := LoadCatalogs(dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCatalogFallback(t *testing.T) {
+	loadTestCatalogs(t, map[string]string{
+		"de.json": `{"locale": {"decimal_separator": ",", "thousand_separator": ".", "date_layout": "02.01.2006"},
+			"messages": {"report.daily": "Tagesbericht"}}`,
+		"ko.json": `{"messages": {"report.daily": "일일"}}`,
+	})
+
+	de := GetCatalog("de")
+	if de.Language != "de" || de.Message("report.daily", nil) != "Tagesbericht" {
+		t.Errorf("de report.daily %q", de.Message("report.daily", nil))
+	}
+	if v := de.Message("report.weekly", nil); v != "Weekly report" {
+		t.Errorf("missing message %q, want the English one", v)
+	}
+
+	// Files merge over the built-in catalog of their language
+	ko := GetCatalog("ko")
+	if ko.Message("report.daily", nil) != "일일" || ko.Message("report.weekly", nil) != builtinCatalogs["ko"].Messages["report.weekly"] {
+		t.Errorf("ko %q %q", ko.Message("report.daily", nil), ko.Message("report.weekly", nil))
+	}
+	if ko.Locale.DateLayout != builtinCatalogs["ko"].Locale.DateLayout {
+		t.Errorf("ko locale %+v", ko.Locale)
+	}
+
+	if GetCatalog("fr").Language != LOCALE_LANGUAGE || GetCatalog("").Language != LOCALE_LANGUAGE {
+		t.Errorf("unknown language gets %s", GetCatalog("fr").Language)
+	}
+	if v := de.Message("no.such.key", nil); v != "no.such.key" {
+		t.Errorf("unknown key %q", v)
+	}
+}
+
+func TestLoadCatalogsRejectsInvalidTemplate(t *testing.T) {
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "de.json"), []byte(`{"messages": {"ping.firing": "{{.Node.Name"}}`), 0644)
+	t.Cleanup(func() { LoadCatalogs("") })
+
+	if err := LoadCatalogs(dir); err == nil {
+		t.Error("catalog with an invalid template loaded")
+	}
+}
+
+func TestCatalogFormatNumber(t *testing.T) {
+	en := &Catalog{Locale: *builtinCatalogs["en"].Locale}
+	de := &Catalog{Locale: Locale{DecimalSeparator: ",", ThousandSeparator: "."}}
+
+	tests := []struct {
+		catalog  *Catalog
+		v        interface{}
+		decimals int
+		want     string
+	}{
+		{en, 1234567.891, 2, "1,234,567.89"},
+		{de, 1234567.891, 2, "1.234.567,89"},
+		{en, int64(-1234), 0, "-1,234"},
+		{en, 999, 1, "999.0"},
+		{en, float32(0.5), 0, "0"},
+		{en, "n/a", 2, "n/a"},
+	}
+
+	for _, test := range tests {
+		if got := test.catalog.FormatNumber(test.v, test.decimals); got != test.want {
+			t.Errorf("%v: %q, want %q", test.v, got, test.want)
+		}
+	}
+}
+
+func TestCatalogFormatDate(t *testing.T) {
+	catalog := &Catalog{Locale: Locale{DateLayout: "2006-01-02"}}
+	at := time.Date(2020, 9, 13, 12, 0, 0, 0, time.Local)
+
+	if v := catalog.FormatDate(at); v != "2020-09-13" {
+		t.Errorf("time %q", v)
+	}
+	if v := catalog.FormatDate(at.Unix()); v != "2020-09-13" {
+		t.Errorf("unix seconds %q", v)
+	}
+	if catalog.FormatDate(time.Time{}) != "-" || catalog.FormatDate(int64(0)) != "-" {
+		t.Error("zero is not -")
+	}
+}
+
+func TestCatalogAlertMessage(t *testing.T) {
+	catalog := GetCatalog(DEFAULT_LANGUAGE)
+
+	message := catalog.AlertMessage(newNotifierEvent())
+	if !strings.Contains(message, "DNS (8.8.8.8) Ping down") || !strings.Contains(message, "12ms") {
+		t.Errorf("firing %q", message)
+	}
+
+	group := NewGroupEvent([]*AlertEvent{newNotifierEvent(), newNotifierEvent()})
+	if message := catalog.AlertMessage(group); !strings.Contains(message, "2 alerts firing") {
+		t.Errorf("group %q", message)
+	}
+}
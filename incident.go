@@ -0,0 +1,427 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	INCIDENT_STATE_OPEN         = "open"
+	INCIDENT_STATE_ACKNOWLEDGED = "acknowledged"
+	INCIDENT_STATE_RESOLVED     = "resolved"
+)
+
+// Incidents keeps an incident for each firing period of an alert.
+// Acknowledged or resolved incidents stop reminders and escalations.
+// Changes are written by Run, the alert manager calls in with its mutex held.
+type Incidents struct {
+	mutex sync.Mutex
+	items []*Incident
+	table map[string]*Incident
+	keys  map[string]*Incident
+	dirty chan struct{}
+}
+
+type Incident struct {
+	ID         string         `json:"id"`
+	Key        string         `json:"key"`
+	NodeName   string         `json:"node_name"`
+	CheckType  string         `json:"check_type"`
+	ItemID     string         `json:"item_id"`
+	ItemName   string         `json:"item_name"`
+	Severity   string         `json:"severity"`
+	State      string         `json:"state"`
+	StartsAt   time.Time      `json:"starts_at"`
+	EndsAt     time.Time      `json:"ends_at"`
+	AckedBy    string         `json:"acked_by"`
+	AckedAt    time.Time      `json:"acked_at"`
+	ResolvedBy string         `json:"resolved_by"`
+	Trace      *TraceRoute    `json:"trace,omitempty"`
+	Notes      []IncidentNote `json:"notes"`
+}
+
+type IncidentNote struct {
+	Author    string    `json:"author"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type IncidentRequest struct {
+	By   string `json:"by"`
+	Note string `json:"note"`
+}
+
+func (self *Incidents) Init() {
+	self.table = make(map[string]*Incident)
+	self.keys = make(map[string]*Incident)
+	self.dirty = make(chan struct{}, 1)
+
+	if b, err := ioutil.ReadFile(INCIDENT_PATH); err == nil {
+		if err := json.Unmarshal(b, &self.items); err != nil {
+			LogFatal("Error on %s file unmarshal (%v).", INCIDENT_PATH, err)
+		}
+	} else if !os.IsNotExist(err) {
+		LogFatal("Can not read %s file (%v).", INCIDENT_PATH, err)
+	}
+
+	// Unresolved incidents of before a restart are attached again by key
+	for _, v := range self.items {
+		self.table[v.ID] = v
+		if v.State != INCIDENT_STATE_RESOLVED {
+			self.keys[v.Key] = v
+		}
+	}
+
+	LogInfo("Incidents has loaded %d incidents.", len(self.items))
+}
+
+func (self *Incidents) Run() {
+	for RUNNING {
+		<-self.dirty
+		self.write()
+	}
+}
+
+// Open starts an incident for an alert which began firing,
+// or returns the unresolved incident of the alert left by a restart.
+func (self *Incidents) Open(alert *Alert) string {
+	if self == nil {
+		return ""
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if v := self.keys[alert.Key]; v != nil {
+		LogInfo("Incident %s of %s attached again", v.ID, v.Key)
+		return v.ID
+	}
+
+	incident := &Incident{
+		ID:        NewID(),
+		Key:       alert.Key,
+		NodeName:  alert.NodeName,
+		CheckType: alert.CheckType,
+		ItemID:    alert.ItemID,
+		ItemName:  alert.ItemName,
+		Severity:  alert.Severity,
+		State:     INCIDENT_STATE_OPEN,
+		StartsAt:  alert.StartsAt,
+		Trace:     PingTrace(alert.Item),
+		Notes:     []IncidentNote{},
+	}
+
+	self.items = append(self.items, incident)
+	self.table[incident.ID] = incident
+	self.keys[incident.Key] = incident
+	self.save()
+	return incident.ID
+}
+
+// Close ends the incident of an alert which stopped firing.
+func (self *Incidents) Close(id string, endsAt time.Time) {
+	if self == nil {
+		return
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	incident := self.table[id]
+	if incident == nil {
+		return
+	}
+
+	incident.State = INCIDENT_STATE_RESOLVED
+	incident.EndsAt = endsAt
+	delete(self.keys, incident.Key)
+	self.save()
+}
+
+// CloseStale ends the incident left by a restart of an alert seen ok,
+// the item recovered while the master was down.
+func (self *Incidents) CloseStale(key string, endsAt time.Time) {
+	if self == nil {
+		return
+	}
+
+	self.mutex.Lock()
+	incident := self.keys[key]
+	self.mutex.Unlock()
+
+	if incident != nil {
+		LogInfo("Incident %s of %s closed, recovered while down", incident.ID, key)
+		self.Close(incident.ID, endsAt)
+	}
+}
+
+// AddNote appends a note of the system to an incident.
+func (self *Incidents) AddNote(id string, author string, text string) {
+	if self == nil {
+		return
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	incident := self.table[id]
+	if incident == nil {
+		return
+	}
+
+	incident.Notes = append(incident.Notes, IncidentNote{
+		Author:    author,
+		Text:      text,
+		CreatedAt: time.Now(),
+	})
+	self.save()
+}
+
+// AddTrace keeps the first trace route of a ping item reported after its incident opened.
+func (self *Incidents) AddTrace(id string, trace *TraceRoute) {
+	if self == nil || trace == nil {
+		return
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	incident := self.table[id]
+	if incident == nil || incident.Trace != nil {
+		return
+	}
+
+	incident.Trace = trace
+	incident.Notes = append(incident.Notes, IncidentNote{
+		Author:    "trace",
+		Text:      trace.String(),
+		CreatedAt: time.Now(),
+	})
+	self.save()
+}
+
+// IsQuiet reports whether an incident no longer wants repeat notifications.
+func (self *Incidents) IsQuiet(id string) bool {
+	if self == nil {
+		return false
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	incident := self.table[id]
+	return incident != nil && incident.State != INCIDENT_STATE_OPEN
+}
+
+// Get returns a copy of an incident, nil if not found.
+func (self *Incidents) Get(id string) *Incident {
+	if self == nil {
+		return nil
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	incident := self.table[id]
+	if incident == nil {
+		return nil
+	}
+
+	v := *incident
+	v.Notes = append([]IncidentNote{}, incident.Notes...)
+	return &v
+}
+
+// Between returns copies of the incidents overlapping since and until.
+func (self *Incidents) Between(since time.Time, until time.Time) []*Incident {
+	if self == nil {
+		return nil
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	var items []*Incident
+	for _, v := range self.items {
+		if v.StartsAt.After(until) || (!v.EndsAt.IsZero() && v.EndsAt.Before(since)) {
+			continue
+		}
+
+		incident := *v
+		incident.Notes = append([]IncidentNote{}, v.Notes...)
+		items = append(items, &incident)
+	}
+	return items
+}
+
+// prune drops incidents resolved before INCIDENT_KEEP_DAYS, must be called with the mutex held.
+func (self *Incidents) prune() {
+	if INCIDENT_KEEP_DAYS <= 0 {
+		return
+	}
+
+	before := time.Now().AddDate(0, 0, -INCIDENT_KEEP_DAYS)
+	items := self.items[:0]
+	for _, v := range self.items {
+		if v.State == INCIDENT_STATE_RESOLVED && v.EndsAt.Before(before) {
+			delete(self.table, v.ID)
+			continue
+		}
+		items = append(items, v)
+	}
+	self.items = items
+}
+
+// save asks Run to write the incidents, must be called with the mutex held.
+func (self *Incidents) save() {
+	self.prune()
+	select {
+	case self.dirty <- struct{}{}:
+	default:
+	}
+}
+
+func (self *Incidents) write() {
+	self.mutex.Lock()
+	b, err := json.Marshal(self.items)
+	self.mutex.Unlock()
+
+	if err == nil {
+		err = SaveJson(INCIDENT_PATH, json.RawMessage(b))
+	}
+	if err != nil {
+		LogFatal("Can not write %s file (%v).", INCIDENT_PATH, err)
+	}
+}
+
+func (self *Incidents) List(c *gin.Context) {
+	state := c.Query("state")
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	items := []*Incident{}
+	for _, v := range self.items {
+		if state == "" || v.State == state {
+			items = append(items, v)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].StartsAt.After(items[j].StartsAt)
+	})
+
+	c.JSON(http.StatusOK, items)
+}
+
+func (self *Incidents) Show(c *gin.Context) {
+	incident := self.Get(c.Param("id"))
+	if incident == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "No matching incident."})
+		return
+	}
+
+	c.JSON(http.StatusOK, incident)
+}
+
+func (self *Incidents) Ack(c *gin.Context) {
+	req := self.bind(c)
+	if req == nil {
+		return
+	}
+
+	self.update(c, req, func(incident *Incident, req *IncidentRequest) bool {
+		if incident.State != INCIDENT_STATE_OPEN {
+			return false
+		}
+		incident.State = INCIDENT_STATE_ACKNOWLEDGED
+		incident.AckedBy = req.By
+		incident.AckedAt = time.Now()
+		return true
+	})
+}
+
+// Resolve closes an incident by hand, the alert keeps its state until the item recovers.
+func (self *Incidents) Resolve(c *gin.Context) {
+	req := self.bind(c)
+	if req == nil {
+		return
+	}
+
+	self.update(c, req, func(incident *Incident, req *IncidentRequest) bool {
+		if incident.State == INCIDENT_STATE_RESOLVED {
+			return false
+		}
+		incident.State = INCIDENT_STATE_RESOLVED
+		incident.ResolvedBy = req.By
+		incident.EndsAt = time.Now()
+		delete(self.keys, incident.Key)
+		return true
+	})
+}
+
+func (self *Incidents) Note(c *gin.Context) {
+	req := self.bind(c)
+	if req == nil {
+		return
+	}
+	if req.Note == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "No note."})
+		return
+	}
+
+	self.update(c, req, func(incident *Incident, req *IncidentRequest) bool {
+		return true
+	})
+}
+
+func (self *Incidents) bind(c *gin.Context) *IncidentRequest {
+	var req IncidentRequest
+	if err := c.BindJSON(&req); err != nil || req.By == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "No by."})
+		return nil
+	}
+	return &req
+}
+
+func (self *Incidents) update(c *gin.Context, req *IncidentRequest, fn func(*Incident, *IncidentRequest) bool) {
+	self.mutex.Lock()
+
+	incident := self.table[c.Param("id")]
+	if incident == nil {
+		self.mutex.Unlock()
+		c.JSON(http.StatusNotFound, gin.H{"message": "No matching incident."})
+		return
+	}
+
+	if !fn(incident, req) {
+		self.mutex.Unlock()
+		c.JSON(http.StatusConflict, gin.H{"message": "Incident is " + incident.State + "."})
+		return
+	}
+
+	if req.Note != "" {
+		incident.Notes = append(incident.Notes, IncidentNote{
+			Author:    req.By,
+			Text:      req.Note,
+			CreatedAt: time.Now(),
+		})
+	}
+	self.save()
+
+	key := incident.Key
+	state := incident.State
+	self.mutex.Unlock()
+
+	LogInfo("Incident %s of %s is %s by %s", c.Param("id"), key, state, req.By)
+	if state != INCIDENT_STATE_OPEN {
+		es.Stop(key)
+	}
+
+	c.JSON(http.StatusOK, self.Get(c.Param("id")))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestIncidents(t *testing.T) *Incidents {
+	old := INCIDENT_PATH
+	INCIDENT_PATH = filepath.Join(t.TempDir(), "incidents.json")
+	t.Cleanup(func() { INCIDENT_PATH = old })
+
+	incidents := &Incidents{}
+	incidents.Init()
+	return incidents
+}
+
+// restart loads the written incidents into a new Incidents.
+func (self *Incidents) restart() *Incidents {
+	self.write()
+
+	incidents := &Incidents{}
+	incidents.Init()
+	return incidents
+}
+
+func TestIncidentsWrittenByRun(t *testing.T) {
+	incidents := newTestIncidents(t)
+	go incidents.Run()
+
+	id := incidents.Open(&Alert{Key: "DB1/ping/8.8.8.8", StartsAt: time.Now()})
+	waitFor(t, "incidents file", func() bool {
+		b, _ := ioutil.ReadFile(INCIDENT_PATH)
+		return strings.Contains(string(b), id)
+	})
+}
+
+func TestIncidentsAfterRestart(t *testing.T) {
+	incidents := newTestIncidents(t)
+	failing := incidents.Open(&Alert{Key: "DB1/ping/8.8.8.8"})
+	recovered := incidents.Open(&Alert{Key: "DB2/ping/8.8.8.8"})
+	closed := incidents.Open(&Alert{Key: "DB3/ping/8.8.8.8"})
+	incidents.Close(closed, time.Now())
+
+	incidents = incidents.restart()
+
+	if id := incidents.Open(&Alert{Key: "DB1/ping/8.8.8.8"}); id != failing {
+		t.Errorf("still failing item opened %s, want %s", id, failing)
+	}
+	if id := incidents.Open(&Alert{Key: "DB3/ping/8.8.8.8"}); id == closed {
+		t.Error("resolved incident attached again")
+	}
+
+	incidents.CloseStale("DB2/ping/8.8.8.8", time.Now())
+	if v := incidents.Get(recovered); v.State != INCIDENT_STATE_RESOLVED || v.EndsAt.IsZero() {
+		t.Errorf("recovered item left %s", v.State)
+	}
+	if id := incidents.Open(&Alert{Key: "DB2/ping/8.8.8.8"}); id == recovered {
+		t.Error("closed incident attached again")
+	}
+}
+
+// Alerts of still failing items go on with their incidents after a restart,
+// recovered items close theirs on the first check.
+func TestAlertManagerAfterRestart(t *testing.T) {
+	oldInc, oldAg := inc, ag
+	t.Cleanup(func() { inc, ag = oldInc, oldAg })
+	ag = newTestGrouper(t)
+
+	inc = newTestIncidents(t)
+	failing := inc.Open(&Alert{Key: "DB1/ping/8.8.8.8"})
+	recovered := inc.Open(&Alert{Key: "DB2/ping/8.8.8.8"})
+	inc = inc.restart()
+
+	manager := &AlertManager{}
+	manager.Init()
+	manager.CheckPing(newPingNode("DB1", "8.8.8.8", false))
+	manager.CheckPing(newPingNode("DB2", "8.8.8.8", true))
+
+	if id := manager.table["DB1/ping/8.8.8.8"].IncidentID; id != failing {
+		t.Errorf("incident %s, want %s", id, failing)
+	}
+	if v := inc.Get(recovered); v.State != INCIDENT_STATE_RESOLVED {
+		t.Errorf("recovered item left %s", v.State)
+	}
+}
+
+func TestIncidentsKeepTrace(t *testing.T) {
+	incidents := newTestIncidents(t)
+	trace := &TraceRoute{Target: "8.8.8.8", Hops: []*TraceHop{{TTL: 1, IpAddr: "10.0.0.1", Sent: 1, Recv: 1}}}
+
+	id := incidents.Open(&Alert{Key: "DB1/ping/8.8.8.8", Item: &PingItem{Trace: trace}})
+	if v := incidents.Get(id); v.Trace != trace || len(v.Notes) != 0 {
+		t.Errorf("opened with %+v", v)
+	}
+
+	// A trace finished after the incident opened is kept once
+	id = incidents.Open(&Alert{Key: "DB2/ping/8.8.8.8", Item: &PingItem{}})
+	incidents.AddTrace(id, trace)
+	incidents.AddTrace(id, &TraceRoute{Target: "other"})
+	v := incidents.Get(id)
+	if v.Trace != trace || len(v.Notes) != 1 || v.Notes[0].Text != trace.String() {
+		t.Errorf("traced %+v", v)
+	}
+
+	// Kept over a restart
+	incidents = incidents.restart()
+	if v := incidents.Get(id); v.Trace == nil || v.Trace.Hops[0].IpAddr != "10.0.0.1" {
+		t.Errorf("trace lost on restart %+v", v)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"gopkg.in/ini.v1"
 )
 
@@ -11,6 +12,19 @@ var (
 	hdd  *HDD
 	ctr  *Collector
 	wh   *WebHook
+	am   *AlertManager
+	dq   *DeliveryQueue
+	ag   *AlertGrouper
+	sl   *Silences
+	mw   *Maintenance
+	dp   *Dependencies
+	es   *Escalator
+	inc  *Incidents
+	au   *AuditLog
+	rp   *Reporter
+	rm   *Remediator
+
+	masterLink *PostOptions
 
 	RUNNING      bool
 	LOCAL_IPADDR string
@@ -21,6 +35,9 @@ var (
 
 	MASTER_NODE_API_HOST string
 
+	MASTER_LINK_TLS             TLSOptions
+	MASTER_LINK_TIMEOUT_SECONDS int
+
 	IS_LOG_ENABLE bool
 	LOG_LEVEL     int
 	LOG_PATH      string
@@ -28,32 +45,108 @@ var (
 	IS_SSL_ENABLE bool
 	SSL_CERT_FILE string
 	SSL_KEY_FILE  string
+	SSL_CLIENT_CA string
 
 	IS_HB_ENABLE        bool
 	HB_INTERVAL_SECONDS int
 	HB_TIMEOUT_SECONDS  int64
 	HB_APPS_CONFIG_JSON string
+	HB_FAIL_AFTER       int
+	HB_RECOVER_AFTER    int
+	HB_FLAP_WINDOW      int
+	HB_FLAP_CHANGES     int
 
 	IS_PING_ENABLE        bool
 	PING_INTERVAL_SECONDS int
 	PING_TIMEOUT_SECONDS  int64
 	PING_TARGETS          []string
 	PING_TARGET_NAMES     []string
+	PING_FAIL_AFTER       int
+	PING_RECOVER_AFTER    int
+	PING_FLAP_WINDOW      int
+	PING_FLAP_CHANGES     int
+
+	IS_PING_TRACE_ENABLE      bool
+	PING_TRACE_PROTOCOL       string
+	PING_TRACE_MAX_HOPS       int
+	PING_TRACE_PROBES         int
+	PING_TRACE_TIMEOUT_MILLIS int
 
 	IS_HDD_ENABLE        bool
 	HDD_INTERVAL_SECONDS int
 	HDD_LIMIT_PERCENT    int
 	HDD_TARGETS          []string
 	HDD_TARGET_NAMES     []string
+	HDD_FAIL_AFTER       int
+	HDD_RECOVER_AFTER    int
+	HDD_FLAP_WINDOW      int
+	HDD_FLAP_CHANGES     int
 
 	IS_WEB_HOOK_ENABLE      bool
 	IS_WEB_HOOK_HB_ENABLE   bool
 	IS_WEB_HOOK_PING_ENABLE bool
 	IS_WEB_HOOK_HDD_ENABLE  bool
 	WEB_HOOK_CONFIG_JSON    string
+
+	ALERT_REMIND_INTERVAL_SECONDS int
+	ALERT_LABELS_JSON             string
+
+	IS_GROUP_ENABLE      bool
+	GROUP_WINDOW_SECONDS int
+	GROUP_BY             []string
+
+	DELIVERY_QUEUE_SIZE          int
+	DELIVERY_MAX_ATTEMPTS        int
+	DELIVERY_BACKOFF_SECONDS     int
+	DELIVERY_MAX_BACKOFF_SECONDS int
+	DELIVERY_DEAD_LETTER_PATH    string
+	DELIVERY_RATE_PER_MINUTE     float64
+	DELIVERY_RATE_BURST          int
+
+	EXEC_MAX_CONCURRENCY int
+	EXEC_TIMEOUT_SECONDS int
+
+	LOCALE_LANGUAGE     string
+	LOCALE_CATALOG_PATH string
+
+	SILENCE_PATH string
+
+	MAINTENANCE_CONFIG_JSON string
+
+	DEPENDENCY_CONFIG_JSON  string
+	DEPENDENCY_HOLD_SECONDS int
+
+	ESCALATION_CONFIG_JSON      string
+	ESCALATION_INTERVAL_SECONDS int
+
+	INCIDENT_PATH      string
+	INCIDENT_KEEP_DAYS int
+
+	AUDIT_PATH      string
+	AUDIT_KEEP_DAYS int
+
+	IS_REPORT_ENABLE       bool
+	REPORT_DAILY_SCHEDULE  string
+	REPORT_WEEKLY_SCHEDULE string
+	REPORT_TIMEZONE        string
+	REPORT_HOOKS           []string
+	REPORT_TOP             int
+
+	IS_REMEDIATION_ENABLE        bool
+	REMEDIATION_CONFIG_JSON      string
+	REMEDIATION_TIMEOUT_SECONDS  int
+	REMEDIATION_MAX_ATTEMPTS     int
+	REMEDIATION_COOLDOWN_SECONDS int
+	REMEDIATION_MAX_PER_HOUR     int
+
+	// Renders web hook payloads without sending them
+	DRY_RUN bool
 )
 
 func main() {
+	flag.BoolVar(&DRY_RUN, "dry-run", false, "render web hook payloads without sending them")
+	flag.Parse()
+
 	LOCAL_IPADDR = GetOutboundIP().String()
 
 	if cfg, err := ini.Load("Config.ini"); err == nil {
@@ -67,6 +160,15 @@ func main() {
 			return
 		}
 
+		MASTER_LINK_TLS = TLSOptions{
+			CAFile:             cfg.Section("MASTER_LINK").Key("CA_FILE").MustString(""),
+			CertFile:           cfg.Section("MASTER_LINK").Key("CERT_FILE").MustString(""),
+			KeyFile:            cfg.Section("MASTER_LINK").Key("KEY_FILE").MustString(""),
+			ServerName:         cfg.Section("MASTER_LINK").Key("SERVER_NAME").MustString(""),
+			InsecureSkipVerify: cfg.Section("MASTER_LINK").Key("INSECURE_SKIP_VERIFY").MustBool(false),
+		}
+		MASTER_LINK_TIMEOUT_SECONDS = cfg.Section("MASTER_LINK").Key("TIMEOUT_SECONDS").MustInt(5)
+
 		IS_LOG_ENABLE = cfg.Section("LOG").Key("IS_ENABLE").MustBool(false)
 		LOG_LEVEL = cfg.Section("LOG").Key("LEVEL").MustInt(0)
 		LOG_PATH = cfg.Section("LOG").Key("BASIC_PATH").MustString("asm.log")
@@ -74,6 +176,7 @@ func main() {
 		IS_SSL_ENABLE = cfg.Section("SSL").Key("IS_ENABLE").MustBool(false)
 		SSL_CERT_FILE = cfg.Section("SSL").Key("CERT_PATH").MustString("")
 		SSL_KEY_FILE = cfg.Section("SSL").Key("KEY_PATH").MustString("")
+		SSL_CLIENT_CA = cfg.Section("SSL").Key("CLIENT_CA_PATH").MustString("")
 
 		if !IS_MASTER && IS_SSL_ENABLE {
 			IS_SSL_ENABLE = false
@@ -84,6 +187,10 @@ func main() {
 		HB_INTERVAL_SECONDS = cfg.Section("HEARTBEAT").Key("INTERVAL_SECONDS").MustInt(60)
 		HB_TIMEOUT_SECONDS = int64(cfg.Section("HEARTBEAT").Key("TIMEOUT_SECONDS").MustInt(120))
 		HB_APPS_CONFIG_JSON = cfg.Section("HEARTBEAT").Key("APPS_CONFIG_JSON").MustString("")
+		HB_FAIL_AFTER = cfg.Section("HEARTBEAT").Key("FAIL_AFTER").MustInt(1)
+		HB_RECOVER_AFTER = cfg.Section("HEARTBEAT").Key("RECOVER_AFTER").MustInt(1)
+		HB_FLAP_WINDOW = cfg.Section("HEARTBEAT").Key("FLAP_WINDOW").MustInt(10)
+		HB_FLAP_CHANGES = cfg.Section("HEARTBEAT").Key("FLAP_CHANGES").MustInt(0)
 
 		if !IS_MASTER && IS_HB_ENABLE {
 			IS_SSL_ENABLE = false
@@ -95,17 +202,31 @@ func main() {
 		PING_TIMEOUT_SECONDS = int64(cfg.Section("PING").Key("TIMEOUT_SECONDS").MustInt(5))
 		PING_TARGETS = cfg.Section("PING").Key("TARGETS").Strings(",")
 		PING_TARGET_NAMES = cfg.Section("PING").Key("TARGET_NAMES").Strings(",")
+		PING_FAIL_AFTER = cfg.Section("PING").Key("FAIL_AFTER").MustInt(1)
+		PING_RECOVER_AFTER = cfg.Section("PING").Key("RECOVER_AFTER").MustInt(1)
+		PING_FLAP_WINDOW = cfg.Section("PING").Key("FLAP_WINDOW").MustInt(10)
+		PING_FLAP_CHANGES = cfg.Section("PING").Key("FLAP_CHANGES").MustInt(0)
 
 		if len(PING_TARGETS) != len(PING_TARGET_NAMES) {
 			LogFatal("Not match ping target, target name items count.")
 			return
 		}
 
+		IS_PING_TRACE_ENABLE = cfg.Section("PING").Key("IS_ENABLE_TRACE").MustBool(false)
+		PING_TRACE_PROTOCOL = cfg.Section("PING").Key("TRACE_PROTOCOL").In(TRACE_PROTOCOL_ICMP, []string{TRACE_PROTOCOL_ICMP, TRACE_PROTOCOL_UDP})
+		PING_TRACE_MAX_HOPS = cfg.Section("PING").Key("TRACE_MAX_HOPS").MustInt(16)
+		PING_TRACE_PROBES = cfg.Section("PING").Key("TRACE_PROBES").MustInt(2)
+		PING_TRACE_TIMEOUT_MILLIS = cfg.Section("PING").Key("TRACE_TIMEOUT_MILLIS").MustInt(500)
+
 		IS_HDD_ENABLE = cfg.Section("HDD").Key("IS_ENABLE").MustBool(false)
 		HDD_INTERVAL_SECONDS = cfg.Section("HDD").Key("INTERVAL_SECONDS").MustInt(300)
 		HDD_LIMIT_PERCENT = cfg.Section("HDD").Key("LIMIT_PERCENT").MustInt(85)
 		HDD_TARGETS = cfg.Section("HDD").Key("TARGETS").Strings(",")
 		HDD_TARGET_NAMES = cfg.Section("HDD").Key("TARGET_NAMES").Strings(",")
+		HDD_FAIL_AFTER = cfg.Section("HDD").Key("FAIL_AFTER").MustInt(1)
+		HDD_RECOVER_AFTER = cfg.Section("HDD").Key("RECOVER_AFTER").MustInt(1)
+		HDD_FLAP_WINDOW = cfg.Section("HDD").Key("FLAP_WINDOW").MustInt(10)
+		HDD_FLAP_CHANGES = cfg.Section("HDD").Key("FLAP_CHANGES").MustInt(0)
 
 		if len(HDD_TARGETS) != len(HDD_TARGET_NAMES) {
 			LogFatal("Not match hdd target, target name items count.")
@@ -113,30 +234,153 @@ func main() {
 		}
 
 		IS_WEB_HOOK_ENABLE = cfg.Section("WEB_HOOK").Key("IS_ENABLE").MustBool(false)
-		IS_WEB_HOOK_HB_ENABLE = cfg.Section("WEB_HOOK").Key("IS_ENABLE_HEARTBEAT").MustBool(false)
-		IS_WEB_HOOK_PING_ENABLE = cfg.Section("WEB_HOOK").Key("IS_ENABLE_PING").MustBool(false)
-		IS_WEB_HOOK_HDD_ENABLE = cfg.Section("WEB_HOOK").Key("IS_ENABLE_HDD").MustBool(false)
+		IS_WEB_HOOK_HB_ENABLE = cfg.Section("WEB_HOOK").Key("IS_ENABLE_HEARTBEAT").MustBool(true)
+		IS_WEB_HOOK_PING_ENABLE = cfg.Section("WEB_HOOK").Key("IS_ENABLE_PING").MustBool(true)
+		IS_WEB_HOOK_HDD_ENABLE = cfg.Section("WEB_HOOK").Key("IS_ENABLE_HDD").MustBool(true)
 		WEB_HOOK_CONFIG_JSON = cfg.Section("WEB_HOOK").Key("CONFIG_JSON").MustString("")
 
 		if !IS_MASTER && IS_WEB_HOOK_ENABLE {
 			IS_WEB_HOOK_ENABLE = false
 			LogInfo("Disable web hook when running slave mode.")
 		}
+
+		ALERT_REMIND_INTERVAL_SECONDS = cfg.Section("ALERT").Key("REMIND_INTERVAL_SECONDS").MustInt(3600)
+		ALERT_LABELS_JSON = cfg.Section("ALERT").Key("LABELS_JSON").MustString("")
+
+		IS_GROUP_ENABLE = cfg.Section("GROUP").Key("IS_ENABLE").MustBool(false)
+		GROUP_WINDOW_SECONDS = cfg.Section("GROUP").Key("WINDOW_SECONDS").MustInt(30)
+		GROUP_BY = cfg.Section("GROUP").Key("BY").Strings(",")
+
+		DELIVERY_QUEUE_SIZE = cfg.Section("DELIVERY").Key("QUEUE_SIZE").MustInt(100)
+		DELIVERY_MAX_ATTEMPTS = cfg.Section("DELIVERY").Key("MAX_ATTEMPTS").MustInt(5)
+		DELIVERY_BACKOFF_SECONDS = cfg.Section("DELIVERY").Key("BACKOFF_SECONDS").MustInt(5)
+		DELIVERY_MAX_BACKOFF_SECONDS = cfg.Section("DELIVERY").Key("MAX_BACKOFF_SECONDS").MustInt(300)
+		DELIVERY_DEAD_LETTER_PATH = cfg.Section("DELIVERY").Key("DEAD_LETTER_PATH").MustString("dead_letters.json")
+		DELIVERY_RATE_PER_MINUTE = cfg.Section("DELIVERY").Key("RATE_PER_MINUTE").MustFloat64(0)
+		DELIVERY_RATE_BURST = cfg.Section("DELIVERY").Key("RATE_BURST").MustInt(10)
+
+		EXEC_MAX_CONCURRENCY = cfg.Section("EXEC").Key("MAX_CONCURRENCY").MustInt(4)
+		EXEC_TIMEOUT_SECONDS = cfg.Section("EXEC").Key("TIMEOUT_SECONDS").MustInt(30)
+
+		LOCALE_LANGUAGE = cfg.Section("LOCALE").Key("LANGUAGE").MustString("ko")
+		LOCALE_CATALOG_PATH = cfg.Section("LOCALE").Key("CATALOG_PATH").MustString("")
+
+		SILENCE_PATH = cfg.Section("SILENCE").Key("PATH").MustString("silences.json")
+
+		MAINTENANCE_CONFIG_JSON = cfg.Section("MAINTENANCE").Key("CONFIG_JSON").MustString("")
+
+		DEPENDENCY_CONFIG_JSON = cfg.Section("DEPENDENCY").Key("CONFIG_JSON").MustString("")
+		DEPENDENCY_HOLD_SECONDS = cfg.Section("DEPENDENCY").Key("HOLD_SECONDS").MustInt(60)
+
+		ESCALATION_CONFIG_JSON = cfg.Section("ESCALATION").Key("CONFIG_JSON").MustString("")
+		ESCALATION_INTERVAL_SECONDS = cfg.Section("ESCALATION").Key("INTERVAL_SECONDS").MustInt(30)
+
+		INCIDENT_PATH = cfg.Section("INCIDENT").Key("PATH").MustString("incidents.json")
+		INCIDENT_KEEP_DAYS = cfg.Section("INCIDENT").Key("KEEP_DAYS").MustInt(30)
+
+		AUDIT_PATH = cfg.Section("AUDIT").Key("PATH").MustString("audit.jsonl")
+		AUDIT_KEEP_DAYS = cfg.Section("AUDIT").Key("KEEP_DAYS").MustInt(30)
+
+		IS_REPORT_ENABLE = cfg.Section("REPORT").Key("IS_ENABLE").MustBool(false)
+		REPORT_DAILY_SCHEDULE = cfg.Section("REPORT").Key("DAILY_SCHEDULE").MustString("0 9 * * *")
+		REPORT_WEEKLY_SCHEDULE = cfg.Section("REPORT").Key("WEEKLY_SCHEDULE").MustString("0 9 * * 1")
+		REPORT_TIMEZONE = cfg.Section("REPORT").Key("TIMEZONE").MustString("")
+		REPORT_HOOKS = cfg.Section("REPORT").Key("HOOKS").Strings(",")
+		REPORT_TOP = cfg.Section("REPORT").Key("TOP").MustInt(5)
+
+		IS_REMEDIATION_ENABLE = cfg.Section("REMEDIATION").Key("IS_ENABLE").MustBool(false)
+		REMEDIATION_CONFIG_JSON = cfg.Section("REMEDIATION").Key("CONFIG_JSON").MustString("remediations.json")
+		REMEDIATION_TIMEOUT_SECONDS = cfg.Section("REMEDIATION").Key("TIMEOUT_SECONDS").MustInt(60)
+		REMEDIATION_MAX_ATTEMPTS = cfg.Section("REMEDIATION").Key("MAX_ATTEMPTS").MustInt(3)
+		REMEDIATION_COOLDOWN_SECONDS = cfg.Section("REMEDIATION").Key("COOLDOWN_SECONDS").MustInt(300)
+		REMEDIATION_MAX_PER_HOUR = cfg.Section("REMEDIATION").Key("MAX_PER_HOUR").MustInt(6)
 	} else {
 		LogFatal("Not found config file '%s'", "Config.ini")
 		return
 	}
 
+	if !IS_MASTER {
+		client, err := NewHttpClient(&MASTER_LINK_TLS, MASTER_LINK_TIMEOUT_SECONDS)
+		if err != nil {
+			LogFatal("Error on master link tls (%v).", err)
+			return
+		}
+		masterLink = &PostOptions{Client: client}
+	}
+
 	RUNNING = true
 
 	if IS_MASTER {
 		ctr = &Collector{}
 		ctr.Init()
+
+		am = &AlertManager{}
+		if err := am.Init(); err != nil {
+			return
+		}
+
+		if IS_GROUP_ENABLE {
+			ag = &AlertGrouper{}
+			ag.Init()
+		}
+
+		sl = &Silences{}
+		sl.Init()
+
+		inc = &Incidents{}
+		inc.Init()
+		go inc.Run()
+
+		au = &AuditLog{}
+		au.Init()
+		go au.Run()
+
+		mw = &Maintenance{}
+		if err := mw.Init(); err != nil {
+			return
+		}
+
+		dp = &Dependencies{}
+		if err := dp.Init(); err != nil {
+			return
+		}
+
+		if err := LoadCatalogs(LOCALE_CATALOG_PATH); err != nil {
+			return
+		}
 	}
 
 	if IS_WEB_HOOK_ENABLE {
 		wh = &WebHook{}
-		wh.Init()
+		if err := wh.Init(); err != nil {
+			return
+		}
+
+		dq = &DeliveryQueue{}
+		dq.Init(wh.items)
+
+		if IS_MASTER {
+			es = &Escalator{}
+			if err := es.Init(); err != nil {
+				return
+			}
+			go es.Run()
+
+			if IS_REPORT_ENABLE {
+				rp = &Reporter{}
+				if err := rp.Init(); err != nil {
+					return
+				}
+				go rp.Run()
+			}
+		}
+	}
+
+	if IS_REMEDIATION_ENABLE {
+		rm = &Remediator{}
+		if err := rm.Init(); err != nil {
+			return
+		}
 	}
 
 	if IS_HB_ENABLE {
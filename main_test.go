@@ -0,0 +1,15 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	RUNNING = true
+	LOCALE_LANGUAGE = DEFAULT_LANGUAGE
+	if err := LoadCatalogs(""); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
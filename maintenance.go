@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// Maintenance holds the recurring maintenance windows of config,
+// checks keep running in a window but their alerts are muted.
+type Maintenance struct {
+	windows []*MaintenanceWindow
+}
+
+type MaintenanceWindow struct {
+	Name            string `json:"name"`
+	Schedule        string `json:"schedule"`
+	DurationMinutes int    `json:"duration_minutes"`
+	Timezone        string `json:"timezone"`
+	AlertMatcher
+
+	cron     *Cron
+	location *time.Location
+}
+
+func (self *Maintenance) Init() error {
+	if MAINTENANCE_CONFIG_JSON == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(MAINTENANCE_CONFIG_JSON)
+	if err != nil {
+		LogFatal("Can not read %s file (%v).", MAINTENANCE_CONFIG_JSON, err)
+		return err
+	}
+
+	if err := json.Unmarshal(b, &self.windows); err != nil {
+		LogFatal("Error on %s file unmarshal (%v).", MAINTENANCE_CONFIG_JSON, err)
+		return err
+	}
+
+	for i, v := range self.windows {
+		if v.Name == "" {
+			v.Name = fmt.Sprintf("maintenance%d", i)
+		}
+
+		if err := v.Init(); err != nil {
+			LogFatal("Error on maintenance %s (%v).", v.Name, err)
+			return err
+		}
+	}
+
+	LogInfo("Maintenance has loaded %d windows.", len(self.windows))
+	return nil
+}
+
+func (self *MaintenanceWindow) Init() error {
+	if self.DurationMinutes <= 0 {
+		return fmt.Errorf("duration_minutes must be positive")
+	}
+
+	cron, err := ParseCron(self.Schedule)
+	if err != nil {
+		return err
+	}
+	self.cron = cron
+
+	self.location = time.Local
+	if self.Timezone != "" {
+		if self.location, err = time.LoadLocation(self.Timezone); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsActive reports whether a window started by the schedule covers now.
+func (self *MaintenanceWindow) IsActive(now time.Time) bool {
+	duration := time.Minute * time.Duration(self.DurationMinutes)
+	start := self.cron.Prev(now.In(self.location), duration)
+	return !start.IsZero() && now.Before(start.Add(duration))
+}
+
+// Find returns the active window of an alert, nil if not in maintenance.
+func (self *Maintenance) Find(alert *Alert) *MaintenanceWindow {
+	if self == nil {
+		return nil
+	}
+
+	now := time.Now()
+	for _, v := range self.windows {
+		if v.Match(alert) && v.IsActive(now) {
+			return v
+		}
+	}
+	return nil
+}
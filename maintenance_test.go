@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindowIsActive(t *testing.T) {
+	// 02:00 to 02:30 in Seoul is 17:00 to 17:30 UTC the day before
+	window := &MaintenanceWindow{Schedule: "0 2 * * *", DurationMinutes: 30, Timezone: "Asia/Seoul"}
+	if err := window.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 3, 13, 17, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{"before", start.Add(-time.Second), false},
+		{"start", start, true},
+		{"inside", start.Add(15 * time.Minute), true},
+		{"last second", start.Add(30*time.Minute - time.Second), true},
+		{"end", start.Add(30 * time.Minute), false},
+		{"after", start.Add(31 * time.Minute), false},
+		{"same hour in UTC", time.Date(2024, 3, 13, 2, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, test := range tests {
+		if got := window.IsActive(test.now); got != test.want {
+			t.Errorf("%s: active %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMaintenanceWindowInitErrors(t *testing.T) {
+	for _, window := range []*MaintenanceWindow{
+		{Schedule: "0 2 * * *"},
+		{Schedule: "0 2 * *", DurationMinutes: 30},
+		{Schedule: "0 2 * * *", DurationMinutes: 30, Timezone: "Nowhere/City"},
+	} {
+		if err := window.Init(); err == nil {
+			t.Errorf("%+v initialized", window)
+		}
+	}
+}
+
+func TestMaintenanceFind(t *testing.T) {
+	m := &Maintenance{windows: []*MaintenanceWindow{
+		{Name: "always", Schedule: "* * * * *", DurationMinutes: 1, AlertMatcher: AlertMatcher{Nodes: []string{"DB*"}}},
+	}}
+	if err := m.windows[0].Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := m.Find(&Alert{NodeName: "DB1"}); w == nil || w.Name != "always" {
+		t.Errorf("DB1 window %v", w)
+	}
+	if w := m.Find(&Alert{NodeName: "WEB1"}); w != nil {
+		t.Errorf("WEB1 window %s", w.Name)
+	}
+
+	var none *Maintenance
+	if none.Find(&Alert{}) != nil {
+		t.Error("nil maintenance found a window")
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	NOTIFIER_TYPE_WEB_HOOK = "webhook"
+	NOTIFIER_TYPE_SLACK    = "slack"
+	NOTIFIER_TYPE_DISCORD  = "discord"
+	NOTIFIER_TYPE_TELEGRAM = "telegram"
+	NOTIFIER_TYPE_TEAMS    = "teams"
+
+	NOTIFIER_TYPE_PAGERDUTY = "pagerduty"
+	NOTIFIER_TYPE_OPSGENIE  = "opsgenie"
+
+	NOTIFIER_TYPE_EMAIL = "email"
+
+	NOTIFIER_TYPE_EXEC = "exec"
+
+	COLOR_RESOLVED = 0x2EB67D
+	COLOR_CRITICAL = 0xE01E5A
+	COLOR_WARNING  = 0xECB22E
+	COLOR_DEFAULT  = 0x439FE0
+)
+
+// Notifier renders an alert into the payload of a destination and delivers it.
+type Notifier interface {
+	Render(event *AlertEvent, content string) (interface{}, error)
+	Deliver(payload interface{}) (int, error)
+}
+
+type NotifierField struct {
+	Name  string
+	Value string
+}
+
+func NewNotifier(item *WebHookItem) (Notifier, error) {
+	switch item.Type {
+	case "", NOTIFIER_TYPE_WEB_HOOK:
+		return &WebHookNotifier{item: item}, nil
+	case NOTIFIER_TYPE_SLACK:
+		return &SlackNotifier{item: item}, nil
+	case NOTIFIER_TYPE_DISCORD:
+		return &DiscordNotifier{item: item}, nil
+	case NOTIFIER_TYPE_TELEGRAM:
+		return &TelegramNotifier{item: item}, nil
+	case NOTIFIER_TYPE_TEAMS:
+		return &TeamsNotifier{item: item}, nil
+	case NOTIFIER_TYPE_PAGERDUTY:
+		return &PagerDutyNotifier{item: item}, nil
+	case NOTIFIER_TYPE_OPSGENIE:
+		return &OpsgenieNotifier{item: item}, nil
+	case NOTIFIER_TYPE_EMAIL:
+		return NewEmailNotifier(item)
+	case NOTIFIER_TYPE_EXEC:
+		return NewExecNotifier(item)
+	}
+	return nil, fmt.Errorf("unknown web hook type %s", item.Type)
+}
+
+type WebHookNotifier struct {
+	item *WebHookItem
+}
+
+func (self *WebHookNotifier) Render(event *AlertEvent, content string) (interface{}, error) {
+	return RenderPayload(self.item.payload, NewTemplateEvent(event, content))
+}
+
+func (self *WebHookNotifier) Deliver(payload interface{}) (int, error) {
+	return PostDelivery(self.item.EndPoint, self.item.Headers, self.item.DataType, payload, self.item.PostOptions())
+}
+
+// PostDelivery posts a payload and fails on a non-2xx response.
+func PostDelivery(url string, headers map[string]string, dataType string, payload interface{}, options *PostOptions) (int, error) {
+	status, _, err := PostWithOptions(url, headers, dataType, payload, options)
+	if err != nil {
+		return status, err
+	}
+	if status < 200 || status > 299 {
+		return status, fmt.Errorf("unexpected status %d", status)
+	}
+	return status, nil
+}
+
+// DecodePayload converts a payload, which may be loaded back from JSON, into target.
+func DecodePayload(payload interface{}, target interface{}) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, target)
+}
+
+func AlertColor(event *AlertEvent) int {
+	if event.Kind == ALERT_EVENT_RESOLVED {
+		return COLOR_RESOLVED
+	}
+
+	switch event.Alert.Severity {
+	case SEVERITY_CRITICAL:
+		return COLOR_CRITICAL
+	case SEVERITY_WARNING:
+		return COLOR_WARNING
+	}
+	return COLOR_DEFAULT
+}
+
+func AlertTitle(catalog *Catalog, event *AlertEvent) string {
+	return catalog.Message("title", NewTemplateEvent(event, ""))
+}
+
+// AlertFields lists node, item and the metrics of the checked item.
+func AlertFields(catalog *Catalog, event *AlertEvent) []NotifierField {
+	alert := &event.Alert
+
+	if event.Kind == ALERT_EVENT_REPORT {
+		return []NotifierField{
+			{catalog.Message("field.period", nil), catalog.FormatDate(alert.StartsAt) + " ~ " + catalog.FormatDate(alert.EndsAt)},
+		}
+	}
+
+	if len(event.Group) > 0 {
+		return []NotifierField{
+			{catalog.Message("field.node", nil), orAny(alert.NodeName)},
+			{catalog.Message("field.check_type", nil), orAny(alert.CheckType)},
+			{catalog.Message("field.severity", nil), alert.Severity},
+			{catalog.Message("field.count", nil), catalog.FormatNumber(len(event.Group), 0)},
+		}
+	}
+
+	fields := []NotifierField{
+		{catalog.Message("field.node", nil), fmt.Sprintf("%s (%s)", alert.NodeName, alert.NodeIpAddr)},
+		{catalog.Message("field.item", nil), fmt.Sprintf("%s (%s)", alert.ItemName, alert.ItemID)},
+		{catalog.Message("field.check_type", nil), alert.CheckType},
+		{catalog.Message("field.severity", nil), alert.Severity},
+	}
+
+	switch item := alert.Item.(type) {
+	case *HeartbeatItem:
+		fields = append(fields,
+			NotifierField{catalog.Message("field.last_check", nil), catalog.FormatDate(item.LastCheckTime)},
+		)
+	case *PingItem:
+		fields = append(fields,
+			NotifierField{catalog.Message("field.rtt", nil), catalog.FormatNumber(item.LastRTT, 0) + "ms"},
+			NotifierField{catalog.Message("field.last_check", nil), catalog.FormatDate(item.LastCheckTime)},
+		)
+	case *HDDItem:
+		fields = append(fields,
+			NotifierField{catalog.Message("field.usage", nil), catalog.FormatNumber(item.Usage, 2) + "%"},
+			NotifierField{catalog.Message("field.free", nil), fmt.Sprintf("%s / %s", item.Free, item.Total)},
+		)
+	}
+
+	if len(alert.Remediations) > 0 {
+		var results []string
+		for _, v := range alert.Remediations {
+			results = append(results, catalog.Message("remediation.result", v))
+		}
+		fields = append(fields, NotifierField{catalog.Message("field.remediation", nil), strings.Join(results, "\n")})
+	}
+	return fields
+}
+
+func orAny(v string) string {
+	if v == "" {
+		return "*"
+	}
+	return v
+}
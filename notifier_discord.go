@@ -0,0 +1,50 @@
+package main
+
+import (
+	"time"
+)
+
+type DiscordNotifier struct {
+	item *WebHookItem
+}
+
+type DiscordMessage struct {
+	Content string         `json:"content"`
+	Embeds  []DiscordEmbed `json:"embeds"`
+}
+
+type DiscordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Color       int            `json:"color"`
+	Fields      []DiscordField `json:"fields"`
+	Timestamp   string         `json:"timestamp"`
+}
+
+type DiscordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+func (self *DiscordNotifier) Render(event *AlertEvent, content string) (interface{}, error) {
+	catalog := GetCatalog(self.item.Language)
+
+	embed := DiscordEmbed{
+		Title:       AlertTitle(catalog, event),
+		Description: content,
+		Color:       AlertColor(event),
+		Timestamp:   event.Time.Format(time.RFC3339),
+	}
+	for _, v := range AlertFields(catalog, event) {
+		embed.Fields = append(embed.Fields, DiscordField{Name: v.Name, Value: v.Value, Inline: true})
+	}
+
+	return &DiscordMessage{
+		Embeds: []DiscordEmbed{embed},
+	}, nil
+}
+
+func (self *DiscordNotifier) Deliver(payload interface{}) (int, error) {
+	return PostDelivery(self.item.EndPoint, self.item.Headers, "json", payload, self.item.PostOptions())
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+const (
+	SMTP_TLS_NONE     = "none"
+	SMTP_TLS_STARTTLS = "starttls"
+	SMTP_TLS_IMPLICIT = "tls"
+
+	SMTP_AUTH_PLAIN = "plain"
+	SMTP_AUTH_LOGIN = "login"
+
+	SMTP_OK = 250
+)
+
+type SmtpConfig struct {
+	Host           string `json:"host"`
+	Port           int    `json:"port"`
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+	Auth           string `json:"auth"`
+	TLS            string `json:"tls"`
+	From           string `json:"from"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+type EmailNotifier struct {
+	item *WebHookItem
+}
+
+type EmailMessage struct {
+	From    string   `json:"from"`
+	To      []string `json:"to"`
+	Cc      []string `json:"cc"`
+	Subject string   `json:"subject"`
+	Text    string   `json:"text"`
+	HTML    string   `json:"html"`
+}
+
+var emailTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif;">
+<h3 style="border-left: 6px solid {{.Color}}; padding-left: 8px;">{{.Title}}</h3>
+<table cellpadding="4" style="border-collapse: collapse;">
+{{range .Fields}}<tr><th align="left">{{.Name}}</th><td>{{.Value}}</td></tr>
+{{end}}</table>
+<pre>{{.Content}}</pre>
+</body>
+</html>
+`))
+
+func NewEmailNotifier(item *WebHookItem) (*EmailNotifier, error) {
+	if item.Smtp == nil || item.Smtp.Host == "" {
+		return nil, fmt.Errorf("email web hook %s needs smtp host", item.Name)
+	}
+	if len(item.To) == 0 {
+		return nil, fmt.Errorf("email web hook %s needs recipients", item.Name)
+	}
+	return &EmailNotifier{item: item}, nil
+}
+
+func (self *EmailNotifier) Render(event *AlertEvent, content string) (interface{}, error) {
+	catalog := GetCatalog(self.item.Language)
+	title := AlertTitle(catalog, event)
+	fields := AlertFields(catalog, event)
+
+	var text strings.Builder
+	for _, v := range fields {
+		text.WriteString(fmt.Sprintf("%s: %s\n", v.Name, v.Value))
+	}
+	text.WriteString("\n")
+	text.WriteString(content)
+
+	var html bytes.Buffer
+	err := emailTemplate.Execute(&html, map[string]interface{}{
+		"Title":   title,
+		"Color":   fmt.Sprintf("#%06X", AlertColor(event)),
+		"Fields":  fields,
+		"Content": content,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &EmailMessage{
+		From:    self.item.Smtp.From,
+		To:      self.item.To,
+		Cc:      self.item.Cc,
+		Subject: title,
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+func (self *EmailNotifier) Deliver(payload interface{}) (int, error) {
+	msg := &EmailMessage{}
+	if err := DecodePayload(payload, msg); err != nil {
+		return 0, err
+	}
+
+	body, err := msg.Bytes()
+	if err != nil {
+		return 0, err
+	}
+
+	tlsConfig, err := self.item.TLS.Config()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := SendMail(self.item.Smtp, tlsConfig, msg.From, append(append([]string{}, msg.To...), msg.Cc...), body); err != nil {
+		return 0, err
+	}
+	return SMTP_OK, nil
+}
+
+// Bytes builds a multipart/alternative message of the text and html bodies.
+func (self *EmailMessage) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	header := []string{
+		"From: " + self.From,
+		"To: " + strings.Join(self.To, ", "),
+	}
+	if len(self.Cc) > 0 {
+		header = append(header, "Cc: "+strings.Join(self.Cc, ", "))
+	}
+	header = append(header,
+		"Subject: "+mime.QEncoding.Encode("utf-8", self.Subject),
+		"Date: "+time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary="+mw.Boundary(),
+	)
+	buf.WriteString(strings.Join(header, "\r\n") + "\r\n\r\n")
+
+	for _, part := range []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", self.Text},
+		{"text/html; charset=utf-8", self.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qw := quotedprintable.NewWriter(w)
+		if _, err := qw.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		qw.Close()
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SendMail is smtp.SendMail with implicit TLS, LOGIN auth and a timeout.
+func SendMail(cfg *SmtpConfig, tlsConfig *tls.Config, from string, to []string, body []byte) error {
+	port := cfg.Port
+	if port == 0 {
+		switch cfg.TLS {
+		case SMTP_TLS_IMPLICIT:
+			port = 465
+		case SMTP_TLS_STARTTLS:
+			port = 587
+		default:
+			port = 25
+		}
+	}
+
+	timeout := time.Second * time.Duration(cfg.TimeoutSeconds)
+	if timeout <= 0 {
+		timeout = time.Second * DEFAULT_TIMEOUT_SECONDS
+	}
+
+	addr := net.JoinHostPort(cfg.Host, fmt.Sprintf("%d", port))
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = cfg.Host
+	}
+
+	var conn net.Conn
+	var err error
+	if cfg.TLS == SMTP_TLS_IMPLICIT {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, timeout)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if cfg.TLS == SMTP_TLS_STARTTLS {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Username != "" {
+		var auth smtp.Auth
+		if strings.ToLower(cfg.Auth) == SMTP_AUTH_LOGIN {
+			auth = &loginAuth{username: cfg.Username, password: cfg.Password}
+		} else {
+			auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+		}
+
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, v := range to {
+		if err := c.Rcpt(v); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+type loginAuth struct {
+	username string
+	password string
+}
+
+func (self *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && server.Name != "localhost" && server.Name != "127.0.0.1" {
+		return "", nil, fmt.Errorf("unencrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (self *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(self.username), nil
+	case "password:":
+		return []byte(self.password), nil
+	}
+	return nil, fmt.Errorf("unexpected server challenge %s", fromServer)
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSmtp is an in-process SMTP server speaking just enough of
+// EHLO, STARTTLS, AUTH PLAIN/LOGIN, MAIL, RCPT and DATA for SendMail.
+type fakeSmtp struct {
+	listener net.Listener
+	tls      *tls.Config
+	certPEM  []byte
+	implicit bool
+	username string
+	password string
+
+	mutex    sync.Mutex
+	sessions []*fakeSmtpSession
+}
+
+type fakeSmtpSession struct {
+	TLS      bool
+	Auth     string
+	Username string
+	Password string
+	From     string
+	To       []string
+	Data     []byte
+}
+
+func newFakeSmtp(t *testing.T, implicit bool) *fakeSmtp {
+	cert, certPEM := newTestCertificate(t)
+
+	server := &fakeSmtp{
+		tls:      &tls.Config{Certificates: []tls.Certificate{cert}},
+		certPEM:  certPEM,
+		implicit: implicit,
+		username: "alert",
+		password: "secret",
+	}
+
+	var err error
+	if implicit {
+		server.listener, err = tls.Listen("tcp", "127.0.0.1:0", server.tls)
+	} else {
+		server.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.listener.Close() })
+
+	go func() {
+		for {
+			conn, err := server.listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (self *fakeSmtp) port() int {
+	return self.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (self *fakeSmtp) last() *fakeSmtpSession {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if len(self.sessions) == 0 {
+		return nil
+	}
+	return self.sessions[len(self.sessions)-1]
+}
+
+func (self *fakeSmtp) serve(conn net.Conn) {
+	defer conn.Close()
+
+	session := &fakeSmtpSession{TLS: self.implicit}
+	self.mutex.Lock()
+	self.sessions = append(self.sessions, session)
+	self.mutex.Unlock()
+
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake ESMTP")
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		arg := strings.TrimSpace(strings.TrimPrefix(line, strings.SplitN(line, " ", 2)[0]))
+
+		self.mutex.Lock()
+		switch verb {
+		case "EHLO", "HELO":
+			ext := []string{"fake"}
+			if !session.TLS {
+				ext = append(ext, "STARTTLS")
+			}
+			ext = append(ext, "AUTH PLAIN LOGIN", "8BITMIME")
+			for i, v := range ext {
+				sep := "-"
+				if i == len(ext)-1 {
+					sep = " "
+				}
+				tp.PrintfLine("250%s%s", sep, v)
+			}
+		case "STARTTLS":
+			tp.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, self.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				self.mutex.Unlock()
+				return
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			session.TLS = true
+		case "AUTH":
+			fields := strings.Fields(arg)
+			session.Auth = strings.ToUpper(fields[0])
+			if session.Auth == "PLAIN" {
+				b, _ := base64.StdEncoding.DecodeString(fields[1])
+				parts := strings.Split(string(b), "\x00")
+				session.Username, session.Password = parts[1], parts[2]
+			} else {
+				self.mutex.Unlock()
+				tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Username:")))
+				user, _ := tp.ReadLine()
+				tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Password:")))
+				pass, _ := tp.ReadLine()
+				self.mutex.Lock()
+
+				b, _ := base64.StdEncoding.DecodeString(user)
+				session.Username = string(b)
+				b, _ = base64.StdEncoding.DecodeString(pass)
+				session.Password = string(b)
+			}
+
+			if session.Username == self.username && session.Password == self.password {
+				tp.PrintfLine("235 authenticated")
+			} else {
+				tp.PrintfLine("535 authentication failed")
+			}
+		case "MAIL":
+			session.From = smtpPath(arg)
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			session.To = append(session.To, smtpPath(arg))
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			self.mutex.Unlock()
+			data, _ := tp.ReadDotBytes()
+			self.mutex.Lock()
+			session.Data = data
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			self.mutex.Unlock()
+			return
+		default:
+			tp.PrintfLine("502 not implemented")
+		}
+		self.mutex.Unlock()
+	}
+}
+
+// smtpPath is the address in brackets of "FROM:<a> BODY=8BITMIME".
+func smtpPath(arg string) string {
+	start, end := strings.Index(arg, "<"), strings.Index(arg, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return arg[start+1 : end]
+}
+
+// newTestCertificate is a self-signed certificate for 127.0.0.1 and its PEM.
+func newTestCertificate(t *testing.T) (tls.Certificate, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// trusting is a client config trusting the certificate of server.
+func (self *fakeSmtp) trusting() *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(self.certPEM)
+	return &tls.Config{RootCAs: pool}
+}
+
+func TestSendMailModes(t *testing.T) {
+	tests := []struct {
+		name     string
+		implicit bool
+		tls      string
+		auth     string
+		username string
+		wantTLS  bool
+		wantAuth string
+	}{
+		{"none without auth", false, SMTP_TLS_NONE, "", "", false, ""},
+		{"none with plain on localhost", false, SMTP_TLS_NONE, SMTP_AUTH_PLAIN, "alert", false, "PLAIN"},
+		{"starttls with plain", false, SMTP_TLS_STARTTLS, SMTP_AUTH_PLAIN, "alert", true, "PLAIN"},
+		{"starttls with login", false, SMTP_TLS_STARTTLS, SMTP_AUTH_LOGIN, "alert", true, "LOGIN"},
+		{"tls with plain", true, SMTP_TLS_IMPLICIT, SMTP_AUTH_PLAIN, "alert", true, "PLAIN"},
+		{"tls with login", true, SMTP_TLS_IMPLICIT, SMTP_AUTH_LOGIN, "alert", true, "LOGIN"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeSmtp(t, tt.implicit)
+			cfg := &SmtpConfig{
+				Host:           "127.0.0.1",
+				Port:           server.port(),
+				Username:       tt.username,
+				Password:       "secret",
+				Auth:           tt.auth,
+				TLS:            tt.tls,
+				TimeoutSeconds: 5,
+			}
+
+			err := SendMail(cfg, server.trusting(), "asm@example.com", []string{"a@example.com", "b@example.com"}, []byte("Subject: x\r\n\r\nbody\r\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			session := server.last()
+			if session.TLS != tt.wantTLS {
+				t.Errorf("tls %v, want %v", session.TLS, tt.wantTLS)
+			}
+			if session.Auth != tt.wantAuth {
+				t.Errorf("auth %q, want %q", session.Auth, tt.wantAuth)
+			}
+			if tt.wantAuth != "" && (session.Username != "alert" || session.Password != "secret") {
+				t.Errorf("credentials %s/%s", session.Username, session.Password)
+			}
+			if session.From != "asm@example.com" || strings.Join(session.To, ",") != "a@example.com,b@example.com" {
+				t.Errorf("envelope %s -> %v", session.From, session.To)
+			}
+			if !bytes.Contains(session.Data, []byte("body")) {
+				t.Errorf("data %q", session.Data)
+			}
+		})
+	}
+}
+
+func TestSendMailRejectedAuth(t *testing.T) {
+	for _, auth := range []string{SMTP_AUTH_PLAIN, SMTP_AUTH_LOGIN} {
+		server := newFakeSmtp(t, false)
+		cfg := &SmtpConfig{Host: "127.0.0.1", Port: server.port(), Username: "alert", Password: "wrong", Auth: auth, TLS: SMTP_TLS_STARTTLS, TimeoutSeconds: 5}
+
+		err := SendMail(cfg, server.trusting(), "asm@example.com", []string{"a@example.com"}, []byte("x"))
+		if err == nil || !strings.Contains(err.Error(), "535") {
+			t.Errorf("%s: error %v, want 535", auth, err)
+		}
+		if session := server.last(); session.From != "" || session.Data != nil {
+			t.Errorf("%s: mail sent after a rejected auth", auth)
+		}
+	}
+}
+
+func TestSendMailUntrustedCertificate(t *testing.T) {
+	server := newFakeSmtp(t, true)
+	cfg := &SmtpConfig{Host: "127.0.0.1", Port: server.port(), TLS: SMTP_TLS_IMPLICIT, TimeoutSeconds: 5}
+
+	if err := SendMail(cfg, &tls.Config{}, "asm@example.com", []string{"a@example.com"}, []byte("x")); err == nil {
+		t.Fatal("no error on an untrusted certificate")
+	}
+}
+
+func TestLoginAuthNeedsEncryption(t *testing.T) {
+	auth := &loginAuth{username: "alert", password: "secret"}
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "mail.example.com"}); err == nil {
+		t.Fatal("LOGIN over plain text to a remote server")
+	}
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "mail.example.com", TLS: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEmailNotifierBody(t *testing.T) {
+	server := newFakeSmtp(t, false)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := ioutil.WriteFile(caFile, server.certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	item := &WebHookItem{
+		Name:     "mail",
+		Type:     NOTIFIER_TYPE_EMAIL,
+		Language: "ko",
+		Smtp:     &SmtpConfig{Host: "127.0.0.1", Port: server.port(), TLS: SMTP_TLS_STARTTLS, From: "asm@example.com", TimeoutSeconds: 5},
+		To:       []string{"ops@example.com"},
+		Cc:       []string{"dev@example.com"},
+		TLS:      &TLSOptions{CAFile: caFile},
+	}
+	notifier := newTestNotifier(t, item)
+
+	event := newNotifierEvent()
+	event.Alert.ItemName = "구글 DNS"
+	content := "첫 줄 = 등호\n" + strings.Repeat("긴 줄 ", 40)
+
+	payload, err := notifier.Render(event, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := notifier.Deliver(payload)
+	if err != nil || status != SMTP_OK {
+		t.Fatalf("deliver %d, %v", status, err)
+	}
+
+	session := server.last()
+	if strings.Join(session.To, ",") != "ops@example.com,dev@example.com" {
+		t.Errorf("recipients %v", session.To)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(session.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get("Cc") != "dev@example.com" {
+		t.Errorf("cc %s", msg.Header.Get("Cc"))
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || !strings.Contains(subject, "구글 DNS") {
+		t.Errorf("subject %q (%v)", subject, err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type %s (%v)", mediaType, err)
+	}
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	var types []string
+	for {
+		part, err := reader.NextRawPart()
+		if err != nil {
+			break
+		}
+		types = append(types, part.Header.Get("Content-Type"))
+		if part.Header.Get("Content-Transfer-Encoding") != "quoted-printable" {
+			t.Errorf("encoding %s", part.Header.Get("Content-Transfer-Encoding"))
+		}
+
+		raw, _ := ioutil.ReadAll(part)
+		// DATA lines are read back with "\n" endings
+		for _, line := range strings.Split(string(raw), "\n") {
+			if len(line) > 76 {
+				t.Errorf("quoted-printable line of %d bytes", len(line))
+			}
+		}
+
+		body, err := ioutil.ReadAll(quotedprintable.NewReader(bytes.NewReader(raw)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain") {
+			if !strings.HasSuffix(string(body), content) {
+				t.Errorf("text body %q", body)
+			}
+		} else if !strings.Contains(string(body), "<pre>첫 줄 = 등호") || !strings.Contains(string(body), "구글 DNS") {
+			t.Errorf("html body %q", body)
+		}
+	}
+
+	if strings.Join(types, ",") != "text/plain; charset=utf-8,text/html; charset=utf-8" {
+		t.Errorf("parts %v", types)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// execSlots limits the commands running at once over every exec hook.
+var execSlots chan struct{}
+
+// ExecNotifier runs a command with the alert in ASM_* environment
+// variables and as JSON on stdin, a non-zero exit is a failed delivery.
+type ExecNotifier struct {
+	item *WebHookItem
+}
+
+type ExecPayload struct {
+	Env   map[string]string `json:"env"`
+	Event interface{}       `json:"event"`
+}
+
+// OutputDeliverer is a Notifier whose deliveries have output for the audit log.
+type OutputDeliverer interface {
+	DeliverOutput(payload interface{}) (int, string, error)
+}
+
+// DeliverOutput delivers with the output of notifiers having one.
+func DeliverOutput(notifier Notifier, payload interface{}) (int, string, error) {
+	if v, ok := notifier.(OutputDeliverer); ok {
+		return v.DeliverOutput(payload)
+	}
+	status, err := notifier.Deliver(payload)
+	return status, "", err
+}
+
+func NewExecNotifier(item *WebHookItem) (*ExecNotifier, error) {
+	if item.Command == "" {
+		return nil, fmt.Errorf("exec web hook %s needs command", item.Name)
+	}
+
+	if execSlots == nil {
+		size := EXEC_MAX_CONCURRENCY
+		if size <= 0 {
+			size = 1
+		}
+		execSlots = make(chan struct{}, size)
+	}
+	return &ExecNotifier{item: item}, nil
+}
+
+func (self *ExecNotifier) Render(event *AlertEvent, content string) (interface{}, error) {
+	alert := &event.Alert
+	env := map[string]string{
+		"ASM_KIND":        event.Kind,
+		"ASM_ALERT_KEY":   alert.Key,
+		"ASM_NODE_NAME":   alert.NodeName,
+		"ASM_NODE_IP":     alert.NodeIpAddr,
+		"ASM_CHECK_TYPE":  alert.CheckType,
+		"ASM_ITEM_ID":     alert.ItemID,
+		"ASM_ITEM_NAME":   alert.ItemName,
+		"ASM_SEVERITY":    alert.Severity,
+		"ASM_STATE":       alert.State,
+		"ASM_INCIDENT_ID": alert.IncidentID,
+		"ASM_STARTS_AT":   formatExecTime(alert.StartsAt),
+		"ASM_ENDS_AT":     formatExecTime(alert.EndsAt),
+		"ASM_CONTENT":     content,
+	}
+
+	return &ExecPayload{
+		Env:   env,
+		Event: NewTemplateEvent(event, content),
+	}, nil
+}
+
+func (self *ExecNotifier) Deliver(payload interface{}) (int, error) {
+	status, _, err := self.DeliverOutput(payload)
+	return status, err
+}
+
+func (self *ExecNotifier) DeliverOutput(payload interface{}) (int, string, error) {
+	p := &ExecPayload{}
+	if err := DecodePayload(payload, p); err != nil {
+		return 0, "", err
+	}
+
+	stdin, err := json.Marshal(p.Event)
+	if err != nil {
+		return 0, "", err
+	}
+
+	timeout := time.Second * time.Duration(self.item.TimeoutSeconds)
+	if timeout <= 0 {
+		timeout = time.Second * time.Duration(EXEC_TIMEOUT_SECONDS)
+	}
+
+	env := os.Environ()
+	for k, v := range self.item.Env {
+		env = append(env, k+"="+v)
+	}
+	for k, v := range p.Env {
+		env = append(env, k+"="+v)
+	}
+
+	execSlots <- struct{}{}
+	defer func() { <-execSlots }()
+
+	return RunCommand(self.item.Command, self.item.Args, env, stdin, timeout)
+}
+
+func formatExecTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
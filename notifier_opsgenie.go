@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const OPSGENIE_API_URL = "https://api.opsgenie.com"
+
+// OpsgenieNotifier creates alerts of the Alert API with the dedup key as alias
+// and closes them by alias on resolve. Payloads keep the path only, the api key
+// goes to the configured end point on delivery.
+type OpsgenieNotifier struct {
+	item *WebHookItem
+}
+
+type OpsgenieRequest struct {
+	Path string      `json:"path"`
+	Body interface{} `json:"body"`
+}
+
+type OpsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description"`
+	Priority    string            `json:"priority"`
+	Source      string            `json:"source"`
+	Entity      string            `json:"entity"`
+	Tags        []string          `json:"tags"`
+	Details     map[string]string `json:"details"`
+}
+
+type OpsgenieClose struct {
+	Source string `json:"source"`
+	Note   string `json:"note"`
+}
+
+var opsgenieSeverities = map[string]string{
+	SEVERITY_CRITICAL: "P1",
+	SEVERITY_WARNING:  "P3",
+}
+
+func (self *OpsgenieNotifier) Render(event *AlertEvent, content string) (interface{}, error) {
+	alert := &event.Alert
+
+	if event.Kind == ALERT_EVENT_RESOLVED {
+		return &OpsgenieRequest{
+			Path: fmt.Sprintf("/v2/alerts/%s/close?identifierType=alias", url.PathEscape(DedupKey(alert))),
+			Body: &OpsgenieClose{
+				Source: NODE_NAME,
+				Note:   content,
+			},
+		}, nil
+	}
+
+	catalog := GetCatalog(self.item.Language)
+	details := make(map[string]string)
+	for _, v := range AlertFields(catalog, event) {
+		details[v.Name] = v.Value
+	}
+
+	message := []rune(AlertTitle(catalog, event))
+	if len(message) > 130 {
+		message = message[:130]
+	}
+
+	return &OpsgenieRequest{
+		Path: "/v2/alerts",
+		Body: &OpsgenieAlert{
+			Message:     string(message),
+			Alias:       DedupKey(alert),
+			Description: content,
+			Priority:    self.item.MapSeverity(alert.Severity, opsgenieSeverities, "P5"),
+			Source:      NODE_NAME,
+			Entity:      alert.NodeName,
+			Tags:        []string{alert.CheckType, alert.Severity, alert.NodeName},
+			Details:     details,
+		},
+	}, nil
+}
+
+func (self *OpsgenieNotifier) Deliver(payload interface{}) (int, error) {
+	request := &OpsgenieRequest{}
+	if err := DecodePayload(payload, request); err != nil {
+		return 0, err
+	}
+
+	endPoint := strings.TrimRight(self.item.EndPoint, "/")
+	if endPoint == "" {
+		endPoint = OPSGENIE_API_URL
+	}
+
+	headers := map[string]string{"Authorization": "GenieKey " + self.item.ApiKey}
+	for k, v := range self.item.Headers {
+		headers[k] = v
+	}
+
+	return PostDelivery(endPoint+request.Path, headers, "json", request.Body, self.item.PostOptions())
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+)
+
+const PAGERDUTY_EVENTS_URL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDutyNotifier sends trigger and resolve events of the Events API v2.
+// The routing key is put in on delivery, payloads are kept as dead letters.
+type PagerDutyNotifier struct {
+	item *WebHookItem
+}
+
+type PagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *PagerDutyPayload `json:"payload,omitempty"`
+}
+
+type PagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp"`
+	Component     string            `json:"component"`
+	Group         string            `json:"group"`
+	Class         string            `json:"class"`
+	CustomDetails map[string]string `json:"custom_details"`
+}
+
+var pagerDutySeverities = map[string]string{
+	SEVERITY_CRITICAL: "critical",
+	SEVERITY_WARNING:  "warning",
+}
+
+func (self *PagerDutyNotifier) Render(event *AlertEvent, content string) (interface{}, error) {
+	alert := &event.Alert
+	pe := &PagerDutyEvent{
+		EventAction: "trigger",
+		DedupKey:    DedupKey(alert),
+	}
+
+	if event.Kind == ALERT_EVENT_RESOLVED {
+		pe.EventAction = "resolve"
+		return pe, nil
+	}
+
+	catalog := GetCatalog(self.item.Language)
+	details := map[string]string{"content": content}
+	for _, v := range AlertFields(catalog, event) {
+		details[v.Name] = v.Value
+	}
+
+	pe.Payload = &PagerDutyPayload{
+		Summary:       AlertTitle(catalog, event),
+		Source:        fmt.Sprintf("%s (%s)", alert.NodeName, alert.NodeIpAddr),
+		Severity:      self.item.MapSeverity(alert.Severity, pagerDutySeverities, "info"),
+		Timestamp:     alert.StartsAt.Format("2006-01-02T15:04:05.000Z07:00"),
+		Component:     alert.ItemName,
+		Group:         alert.NodeName,
+		Class:         alert.CheckType,
+		CustomDetails: details,
+	}
+	return pe, nil
+}
+
+func (self *PagerDutyNotifier) Deliver(payload interface{}) (int, error) {
+	endPoint := self.item.EndPoint
+	if endPoint == "" {
+		endPoint = PAGERDUTY_EVENTS_URL
+	}
+
+	pe := &PagerDutyEvent{}
+	if err := DecodePayload(payload, pe); err != nil {
+		return 0, err
+	}
+	pe.RoutingKey = self.item.RoutingKey
+
+	return PostDelivery(endPoint, self.item.Headers, "json", pe, self.item.PostOptions())
+}
+
+// DedupKey is stable for an item of a node, so a resolve closes what its trigger opened.
+func DedupKey(alert *Alert) string {
+	return "asm/" + alert.Key
+}
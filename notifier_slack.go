@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+)
+
+type SlackNotifier struct {
+	item *WebHookItem
+}
+
+type SlackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []SlackAttachment `json:"attachments"`
+}
+
+type SlackAttachment struct {
+	Fallback string       `json:"fallback"`
+	Color    string       `json:"color"`
+	Title    string       `json:"title"`
+	Text     string       `json:"text"`
+	Fields   []SlackField `json:"fields"`
+	Ts       int64        `json:"ts"`
+}
+
+type SlackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+func (self *SlackNotifier) Render(event *AlertEvent, content string) (interface{}, error) {
+	catalog := GetCatalog(self.item.Language)
+	title := AlertTitle(catalog, event)
+
+	attachment := SlackAttachment{
+		Fallback: title,
+		Color:    fmt.Sprintf("#%06X", AlertColor(event)),
+		Title:    title,
+		Text:     content,
+		Ts:       event.Time.Unix(),
+	}
+	for _, v := range AlertFields(catalog, event) {
+		attachment.Fields = append(attachment.Fields, SlackField{Title: v.Name, Value: v.Value, Short: true})
+	}
+
+	return &SlackMessage{
+		Text:        title,
+		Attachments: []SlackAttachment{attachment},
+	}, nil
+}
+
+func (self *SlackNotifier) Deliver(payload interface{}) (int, error) {
+	return PostDelivery(self.item.EndPoint, self.item.Headers, "json", payload, self.item.PostOptions())
+}
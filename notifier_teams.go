@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TeamsNotifier posts a MessageCard to an incoming web hook connector.
+type TeamsNotifier struct {
+	item *WebHookItem
+}
+
+type TeamsMessageCard struct {
+	Type       string         `json:"@type"`
+	Context    string         `json:"@context"`
+	ThemeColor string         `json:"themeColor"`
+	Summary    string         `json:"summary"`
+	Title      string         `json:"title"`
+	Sections   []TeamsSection `json:"sections"`
+}
+
+type TeamsSection struct {
+	ActivityTitle string      `json:"activityTitle"`
+	Facts         []TeamsFact `json:"facts"`
+	Text          string      `json:"text"`
+	Markdown      bool        `json:"markdown"`
+}
+
+type TeamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func (self *TeamsNotifier) Render(event *AlertEvent, content string) (interface{}, error) {
+	catalog := GetCatalog(self.item.Language)
+	title := AlertTitle(catalog, event)
+
+	section := TeamsSection{
+		ActivityTitle: fmt.Sprintf("%s/%s", event.Alert.NodeName, event.Alert.NodeIpAddr),
+		Text:          strings.ReplaceAll(content, "\n", "  \n"),
+		Markdown:      true,
+	}
+	for _, v := range AlertFields(catalog, event) {
+		section.Facts = append(section.Facts, TeamsFact{Name: v.Name, Value: v.Value})
+	}
+
+	return &TeamsMessageCard{
+		Type:       "MessageCard",
+		Context:    "http://schema.org/extensions",
+		ThemeColor: fmt.Sprintf("%06X", AlertColor(event)),
+		Summary:    title,
+		Title:      title,
+		Sections:   []TeamsSection{section},
+	}, nil
+}
+
+func (self *TeamsNotifier) Deliver(payload interface{}) (int, error) {
+	return PostDelivery(self.item.EndPoint, self.item.Headers, "json", payload, self.item.PostOptions())
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// TelegramNotifier posts to the sendMessage method of a bot,
+// end_point is https://api.telegram.org/bot<token>/sendMessage.
+type TelegramNotifier struct {
+	item *WebHookItem
+}
+
+type TelegramMessage struct {
+	ChatID                string `json:"chat_id"`
+	Text                  string `json:"text"`
+	ParseMode             string `json:"parse_mode"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+func (self *TelegramNotifier) Render(event *AlertEvent, content string) (interface{}, error) {
+	catalog := GetCatalog(self.item.Language)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s <b>%s</b>\n\n", telegramMark(event), html.EscapeString(AlertTitle(catalog, event))))
+	for _, v := range AlertFields(catalog, event) {
+		sb.WriteString(fmt.Sprintf("<b>%s</b>: %s\n", html.EscapeString(v.Name), html.EscapeString(v.Value)))
+	}
+	sb.WriteString(fmt.Sprintf("\n<pre>%s</pre>", html.EscapeString(content)))
+
+	return &TelegramMessage{
+		ChatID:                self.item.ChatID,
+		Text:                  sb.String(),
+		ParseMode:             "HTML",
+		DisableWebPagePreview: true,
+	}, nil
+}
+
+func (self *TelegramNotifier) Deliver(payload interface{}) (int, error) {
+	return PostDelivery(self.item.EndPoint, self.item.Headers, "json", payload, self.item.PostOptions())
+}
+
+// telegramMark stands in for colors which telegram messages do not have.
+func telegramMark(event *AlertEvent) string {
+	switch AlertColor(event) {
+	case COLOR_RESOLVED:
+		return "🟢"
+	case COLOR_CRITICAL:
+		return "🔴"
+	case COLOR_WARNING:
+		return "🟠"
+	}
+	return "🔵"
+}
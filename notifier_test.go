@@ -0,0 +1,381 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubServer answers every request with status and keeps the last body.
+type stubServer struct {
+	*httptest.Server
+	mutex       sync.Mutex
+	status      int
+	body        []byte
+	contentType string
+	header      http.Header
+	path        string
+	requests    int
+}
+
+func newStubServer(t *testing.T, status int) *stubServer {
+	stub := &stubServer{status: status}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		stub.mutex.Lock()
+		stub.body = body
+		stub.contentType = r.Header.Get("Content-Type")
+		stub.header = r.Header
+		stub.path = r.URL.RequestURI()
+		stub.requests++
+		status := stub.status
+		stub.mutex.Unlock()
+
+		w.WriteHeader(status)
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+// decoded is the last body as generic JSON.
+func (self *stubServer) decoded(t *testing.T) map[string]interface{} {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	var v map[string]interface{}
+	if err := json.Unmarshal(self.body, &v); err != nil {
+		t.Fatalf("body is not JSON (%v): %s", err, self.body)
+	}
+	return v
+}
+
+func newNotifierEvent() *AlertEvent {
+	return &AlertEvent{
+		Kind:     ALERT_EVENT_FIRING,
+		OldState: ALERT_STATE_OK,
+		NewState: ALERT_STATE_FIRING,
+		Time:     time.Unix(1600000000, 0),
+		Alert: Alert{
+			Key:        "MAIN/ping/8.8.8.8",
+			NodeName:   "MAIN",
+			NodeIpAddr: "10.0.0.1",
+			CheckType:  CHECK_TYPE_PING,
+			ItemID:     "8.8.8.8",
+			ItemName:   "DNS",
+			Severity:   SEVERITY_CRITICAL,
+			State:      ALERT_STATE_FIRING,
+			StartsAt:   time.Unix(1600000000, 0),
+			Item:       &PingItem{Name: "DNS", IpAddr: "8.8.8.8", LastRTT: 12},
+		},
+	}
+}
+
+func newTestNotifier(t *testing.T, item *WebHookItem) Notifier {
+	if item.Data != nil {
+		payload, err := CompilePayload("data", map[string]interface{}(item.Data), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		item.payload = payload
+	}
+
+	notifier, err := NewNotifier(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return notifier
+}
+
+// jsonPath walks decoded JSON by map keys and array indexes, nil if missing.
+func jsonPath(v interface{}, keys ...interface{}) interface{} {
+	for _, k := range keys {
+		switch k := k.(type) {
+		case string:
+			m, _ := v.(map[string]interface{})
+			v = m[k]
+		case int:
+			a, _ := v.([]interface{})
+			if k >= len(a) {
+				return nil
+			}
+			v = a[k]
+		}
+	}
+	return v
+}
+
+func TestNotifierPayloads(t *testing.T) {
+	tests := []struct {
+		name  string
+		item  WebHookItem
+		check func(t *testing.T, body map[string]interface{})
+	}{
+		{
+			"webhook",
+			WebHookItem{Type: NOTIFIER_TYPE_WEB_HOOK, DataType: "json", Data: map[string]interface{}{
+				"text": "{{.Kind}} {{.Node.Name}} {{.ItemName}}",
+				"rtt":  "{{.Item.LastRTT}}",
+			}},
+			func(t *testing.T, body map[string]interface{}) {
+				if body["text"] != "firing MAIN DNS" || body["rtt"] != "12" {
+					t.Errorf("data %v", body)
+				}
+			},
+		},
+		{
+			"slack",
+			WebHookItem{Type: NOTIFIER_TYPE_SLACK},
+			func(t *testing.T, body map[string]interface{}) {
+				if !strings.Contains(body["text"].(string), "DNS") {
+					t.Errorf("text %v", body["text"])
+				}
+				if jsonPath(body, "attachments", 0, "color") != "#E01E5A" {
+					t.Errorf("color %v", jsonPath(body, "attachments", 0, "color"))
+				}
+				if jsonPath(body, "attachments", 0, "fields", 0, "title") != "Node" {
+					t.Errorf("fields %v", jsonPath(body, "attachments", 0, "fields"))
+				}
+				if jsonPath(body, "attachments", 0, "ts") != float64(1600000000) {
+					t.Errorf("ts %v", jsonPath(body, "attachments", 0, "ts"))
+				}
+			},
+		},
+		{
+			"discord",
+			WebHookItem{Type: NOTIFIER_TYPE_DISCORD},
+			func(t *testing.T, body map[string]interface{}) {
+				if !strings.Contains(jsonPath(body, "embeds", 0, "title").(string), "DNS") {
+					t.Errorf("title %v", jsonPath(body, "embeds", 0, "title"))
+				}
+				if jsonPath(body, "embeds", 0, "color") != float64(COLOR_CRITICAL) {
+					t.Errorf("color %v", jsonPath(body, "embeds", 0, "color"))
+				}
+				if jsonPath(body, "embeds", 0, "fields", 0, "name") != "Node" {
+					t.Errorf("fields %v", jsonPath(body, "embeds", 0, "fields"))
+				}
+			},
+		},
+		{
+			"telegram",
+			WebHookItem{Type: NOTIFIER_TYPE_TELEGRAM, ChatID: "-100"},
+			func(t *testing.T, body map[string]interface{}) {
+				if body["chat_id"] != "-100" || body["parse_mode"] != "HTML" {
+					t.Errorf("chat_id %v, parse_mode %v", body["chat_id"], body["parse_mode"])
+				}
+				text := body["text"].(string)
+				if !strings.Contains(text, "<b>Node</b>: MAIN (10.0.0.1)") || !strings.Contains(text, "<pre>") {
+					t.Errorf("text %s", text)
+				}
+			},
+		},
+		{
+			"teams",
+			WebHookItem{Type: NOTIFIER_TYPE_TEAMS},
+			func(t *testing.T, body map[string]interface{}) {
+				if body["@type"] != "MessageCard" || body["@context"] != "http://schema.org/extensions" {
+					t.Errorf("card %v %v", body["@type"], body["@context"])
+				}
+				if jsonPath(body, "sections", 0, "activityTitle") != "MAIN/10.0.0.1" {
+					t.Errorf("section %v", jsonPath(body, "sections", 0))
+				}
+				if jsonPath(body, "sections", 0, "facts", 0, "name") != "Node" {
+					t.Errorf("facts %v", jsonPath(body, "sections", 0, "facts"))
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newStubServer(t, http.StatusOK)
+			item := tt.item
+			item.Name = tt.name
+			item.Language = "en"
+			item.EndPoint = stub.URL
+			notifier := newTestNotifier(t, &item)
+
+			event := newNotifierEvent()
+			payload, err := notifier.Render(event, GetCatalog("en").AlertMessage(event))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			status, err := notifier.Deliver(payload)
+			if err != nil || status != http.StatusOK {
+				t.Fatalf("deliver %d, %v", status, err)
+			}
+			if stub.contentType != "application/json" {
+				t.Errorf("content type %s", stub.contentType)
+			}
+			tt.check(t, stub.decoded(t))
+		})
+	}
+}
+
+func TestNotifierErrorStatus(t *testing.T) {
+	for _, notifierType := range []string{NOTIFIER_TYPE_WEB_HOOK, NOTIFIER_TYPE_SLACK, NOTIFIER_TYPE_DISCORD, NOTIFIER_TYPE_TELEGRAM, NOTIFIER_TYPE_TEAMS} {
+		for _, code := range []int{http.StatusBadRequest, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusServiceUnavailable} {
+			stub := newStubServer(t, code)
+			item := &WebHookItem{Name: notifierType, Type: notifierType, DataType: "json", EndPoint: stub.URL, Data: map[string]interface{}{"a": "b"}}
+			notifier := newTestNotifier(t, item)
+
+			payload, err := notifier.Render(newNotifierEvent(), "content")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			status, err := notifier.Deliver(payload)
+			if err == nil || status != code {
+				t.Errorf("%s on %d: status %d, error %v", notifierType, code, status, err)
+			}
+		}
+	}
+}
+
+func TestPostDeliveryUnreachable(t *testing.T) {
+	stub := newStubServer(t, http.StatusOK)
+	url := stub.URL
+	stub.Close()
+
+	if _, err := PostDelivery(url, nil, "json", map[string]string{}, nil); err == nil {
+		t.Fatal("no error on a closed server")
+	}
+}
+
+// Payloads of dead letters are loaded back as generic JSON and must deliver the same body.
+func TestDecodePayloadRoundTrip(t *testing.T) {
+	for _, notifierType := range []string{NOTIFIER_TYPE_SLACK, NOTIFIER_TYPE_DISCORD, NOTIFIER_TYPE_TELEGRAM, NOTIFIER_TYPE_TEAMS} {
+		stub := newStubServer(t, http.StatusOK)
+		item := &WebHookItem{Name: notifierType, Type: notifierType, EndPoint: stub.URL, ChatID: "1"}
+		notifier := newTestNotifier(t, item)
+
+		payload, err := notifier.Render(newNotifierEvent(), "content")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := notifier.Deliver(payload); err != nil {
+			t.Fatal(err)
+		}
+		direct := string(stub.body)
+
+		b, _ := json.Marshal(payload)
+		var loaded interface{}
+		if err := json.Unmarshal(b, &loaded); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := notifier.Deliver(loaded); err != nil {
+			t.Fatal(err)
+		}
+
+		var x, y interface{}
+		json.Unmarshal([]byte(direct), &x)
+		json.Unmarshal(stub.body, &y)
+		bx, _ := json.Marshal(x)
+		by, _ := json.Marshal(y)
+		if string(bx) != string(by) {
+			t.Errorf("%s: loaded payload posted %s, want %s", notifierType, by, bx)
+		}
+	}
+}
+
+// Payloads end up in dead letters and the audit log, credentials only go out on delivery.
+func TestPagingCredentials(t *testing.T) {
+	tests := []struct {
+		item  WebHookItem
+		check func(t *testing.T, stub *stubServer)
+	}{
+		{
+			WebHookItem{Type: NOTIFIER_TYPE_PAGERDUTY, RoutingKey: "secret-routing-key"},
+			func(t *testing.T, stub *stubServer) {
+				body := stub.decoded(t)
+				if body["routing_key"] != "secret-routing-key" || body["dedup_key"] != "asm/MAIN/ping/8.8.8.8" {
+					t.Errorf("body %v", body)
+				}
+			},
+		},
+		{
+			WebHookItem{Type: NOTIFIER_TYPE_OPSGENIE, ApiKey: "secret-api-key"},
+			func(t *testing.T, stub *stubServer) {
+				if stub.header.Get("Authorization") != "GenieKey secret-api-key" {
+					t.Errorf("authorization %q", stub.header.Get("Authorization"))
+				}
+				if stub.path != "/v2/alerts" {
+					t.Errorf("path %s", stub.path)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		stub := newStubServer(t, http.StatusAccepted)
+		item := test.item
+		item.Name = item.Type
+		item.EndPoint = stub.URL
+		notifier := newTestNotifier(t, &item)
+
+		payload, err := notifier.Render(newNotifierEvent(), "content")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, _ := json.Marshal(payload)
+		if strings.Contains(string(b), "secret") || strings.Contains(string(b), stub.URL) {
+			t.Errorf("%s: credentials or end point in payload %s", item.Type, b)
+		}
+
+		var loaded interface{}
+		json.Unmarshal(b, &loaded)
+		if _, err := notifier.Deliver(loaded); err != nil {
+			t.Fatalf("%s: %v", item.Type, err)
+		}
+		test.check(t, stub)
+	}
+}
+
+func TestDecodePayload(t *testing.T) {
+	var loaded interface{}
+	json.Unmarshal([]byte(`{"text": "a", "attachments": [{"title": "b", "ts": 1}]}`), &loaded)
+
+	var message SlackMessage
+	if err := DecodePayload(loaded, &message); err != nil {
+		t.Fatal(err)
+	}
+	if message.Text != "a" || len(message.Attachments) != 1 || message.Attachments[0].Title != "b" || message.Attachments[0].Ts != 1 {
+		t.Fatalf("decoded %+v", message)
+	}
+
+	if err := DecodePayload(map[string]interface{}{"text": 1}, &message); err == nil {
+		t.Fatal("no error on a mistyped payload")
+	}
+}
+
+func TestNewNotifierUnknownType(t *testing.T) {
+	if _, err := NewNotifier(&WebHookItem{Type: "fax"}); err == nil {
+		t.Fatal("no error on an unknown type")
+	}
+}
+
+func TestNewTestEvent(t *testing.T) {
+	for _, checkType := range []string{CHECK_TYPE_HEARTBEAT, CHECK_TYPE_PING, CHECK_TYPE_HDD} {
+		firing := NewTestEvent(checkType, ALERT_EVENT_FIRING)
+		resolved := NewTestEvent(checkType, ALERT_EVENT_RESOLVED)
+
+		if !strings.HasPrefix(firing.Alert.Key, "test/") || !strings.HasPrefix(DedupKey(&firing.Alert), "asm/test/") {
+			t.Errorf("%s: key %s is not synthetic", checkType, firing.Alert.Key)
+		}
+		if resolved.Alert.Key != firing.Alert.Key {
+			t.Errorf("%s: resolved key %s, firing %s", checkType, resolved.Alert.Key, firing.Alert.Key)
+		}
+	}
+
+	if NewTestEvent("unknown", ALERT_EVENT_FIRING) != nil {
+		t.Error("event of an unknown check type")
+	}
+}
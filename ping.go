@@ -4,21 +4,25 @@ import (
 	"fmt"
 	"github.com/tatsushid/go-fastping"
 	"net"
+	"sync"
 	"time"
 )
 
 type Ping struct {
+	mutex sync.Mutex
 	items []*PingItem
 	table map[string]*PingItem
 }
 
 type PingItem struct {
-	Name          string `json:"name"`
-	IpAddr        string `json:"ip_addr"`
-	LastCheckTime int64  `json:"last_check_time_seconds"`
-	LastCheck     string `json:"last_check_time"`
-	LastRTT       int64  `json:"last_check_rtt_mills"`
-	IsOnline      bool   `json:"is_online"`
+	Name          string      `json:"name"`
+	IpAddr        string      `json:"ip_addr"`
+	LastCheckTime int64       `json:"last_check_time_seconds"`
+	LastCheck     string      `json:"last_check_time"`
+	LastRTT       int64       `json:"last_check_rtt_mills"`
+	IsOnline      bool        `json:"is_online"`
+	Trace         *TraceRoute `json:"trace,omitempty"`
+	CheckState
 }
 
 func (self *Ping) Run() {
@@ -38,31 +42,23 @@ func (self *Ping) Run() {
 		self.table[ipaddr] = pi
 	}
 
+	threshold := NewThreshold(PING_FAIL_AFTER, PING_RECOVER_AFTER, PING_FLAP_WINDOW, PING_FLAP_CHANGES)
+
 	// Loop
 	go self.checkLoop()
 
 	<-time.After(time.Second * time.Duration(PING_TIMEOUT_SECONDS))
 	for RUNNING {
-		for _, v := range self.items {
-			now := time.Now().Unix()
-
-			if now-v.LastCheckTime > PING_TIMEOUT_SECONDS {
-				LogDebug("Ping check fail on %s (%s), %s", v.Name, v.IpAddr, v.LastCheck)
-				v.IsOnline = false
-			} else {
-				LogDebug("Ping check success on %s (%s), RTT %dms (%s)", v.Name, v.IpAddr, v.LastRTT, v.LastCheck)
-				v.IsOnline = true
-			}
-		}
+		self.check(threshold)
 
-		data := NodeData{
-			Name:      NODE_NAME,
-			IpAddr:    LOCAL_IPADDR,
-			PingItems: self.items,
+		if IS_PING_TRACE_ENABLE {
+			self.trace()
 		}
 
+		data := self.report()
+
 		if !IS_MASTER {
-			go Post(parentNodeUrl, nil, "json", data)
+			go PostWithOptions(parentNodeUrl, nil, "json", data, masterLink)
 		} else {
 			go ctr.ProcessPing(data)
 		}
@@ -72,6 +68,69 @@ func (self *Ping) Run() {
 	}
 }
 
+// check observes the items against their last replies.
+func (self *Ping) check(threshold *Threshold) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for _, v := range self.items {
+		now := time.Now().Unix()
+
+		if now-v.LastCheckTime > PING_TIMEOUT_SECONDS {
+			LogDebug("Ping check fail on %s (%s), %s", v.Name, v.IpAddr, v.LastCheck)
+			v.IsOnline = v.Observe(false, v.IsOnline, threshold)
+		} else {
+			LogDebug("Ping check success on %s (%s), RTT %dms (%s)", v.Name, v.IpAddr, v.LastRTT, v.LastCheck)
+			v.IsOnline = v.Observe(true, v.IsOnline, threshold)
+		}
+	}
+}
+
+// report returns a copy of the items to report.
+func (self *Ping) report() NodeData {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	data := NodeData{
+		Name:      NODE_NAME,
+		IpAddr:    LOCAL_IPADDR,
+		PingItems: self.items,
+	}
+	rm.Check(&data)
+	return data.Copy()
+}
+
+func (self *Ping) trace() {
+	var wg sync.WaitGroup
+
+	for _, v := range self.items {
+		if v.IsOnline {
+			v.Trace = nil
+			continue
+		}
+
+		if v.Trace != nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(item *PingItem) {
+			defer wg.Done()
+
+			LogDebug("Trace route to %s (%s)", item.Name, item.IpAddr)
+			item.Trace = Trace(
+				item.IpAddr,
+				PING_TRACE_PROTOCOL,
+				PING_TRACE_MAX_HOPS,
+				PING_TRACE_PROBES,
+				time.Millisecond*time.Duration(PING_TRACE_TIMEOUT_MILLIS),
+			)
+		}(v)
+	}
+
+	wg.Wait()
+}
+
 func (self *Ping) checkLoop() error {
 	p := fastping.NewPinger()
 
@@ -84,17 +143,7 @@ func (self *Ping) checkLoop() error {
 	}
 
 	p.MaxRTT = time.Second * time.Duration(PING_TIMEOUT_SECONDS)
-	p.OnRecv = func(addr *net.IPAddr, rtt time.Duration) {
-		LogVerbose("IP Addr: %s receive, RTT: %v", addr.String(), rtt)
-		item := self.table[addr.String()]
-
-		if item != nil {
-			now := time.Now()
-			item.LastRTT = rtt.Milliseconds()
-			item.LastCheckTime = now.Unix()
-			item.LastCheck = time.Unix(0, now.UnixNano()).String()
-		}
-	}
+	p.OnRecv = self.receive
 	p.OnIdle = func() {
 		//
 	}
@@ -102,3 +151,27 @@ func (self *Ping) checkLoop() error {
 	p.RunLoop()
 	return nil
 }
+
+// receive records a reply of a target.
+func (self *Ping) receive(addr *net.IPAddr, rtt time.Duration) {
+	LogVerbose("IP Addr: %s receive, RTT: %v", addr.String(), rtt)
+	item := self.table[addr.String()]
+
+	if item != nil {
+		self.mutex.Lock()
+		defer self.mutex.Unlock()
+
+		now := time.Now()
+		item.LastRTT = rtt.Milliseconds()
+		item.LastCheckTime = now.Unix()
+		item.LastCheck = time.Unix(0, now.UnixNano()).String()
+	}
+}
+
+// PingTrace returns the trace route reported with an item, nil if none.
+func PingTrace(item interface{}) *TraceRoute {
+	if item, ok := item.(*PingItem); ok {
+		return item.Trace
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimit is a token bucket refilled by PerMinute up to Burst.
+type RateLimit struct {
+	PerMinute float64 `json:"per_minute"`
+	Burst     int     `json:"burst"`
+}
+
+// RateLimiter holds back events over the limit of a hook and hands
+// them over together once a token is free again.
+type RateLimiter struct {
+	mutex      sync.Mutex
+	limit      RateLimit
+	tokens     float64
+	last       time.Time
+	suppressed []*AlertEvent
+	timer      *time.Timer
+	flush      func([]*AlertEvent)
+
+	// Clock of the bucket, replaced by tests
+	now func() time.Time
+}
+
+func NewRateLimiter(limit RateLimit, flush func([]*AlertEvent)) *RateLimiter {
+	if limit.Burst <= 0 {
+		limit.Burst = 1
+	}
+
+	return &RateLimiter{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   time.Now(),
+		flush:  flush,
+		now:    time.Now,
+	}
+}
+
+// Allow takes a token, false if the hook is over its limit or already holding events back.
+func (self *RateLimiter) Allow() bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return len(self.suppressed) == 0 && self.take()
+}
+
+// Suppress holds an event until a token is free.
+func (self *RateLimiter) Suppress(event *AlertEvent) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.suppressed = append(self.suppressed, event)
+	if self.timer == nil {
+		self.timer = time.AfterFunc(self.wait(), self.release)
+	}
+}
+
+func (self *RateLimiter) release() {
+	self.mutex.Lock()
+	if !self.take() {
+		self.timer = time.AfterFunc(self.wait(), self.release)
+		self.mutex.Unlock()
+		return
+	}
+
+	events := self.suppressed
+	self.suppressed = nil
+	self.timer = nil
+	self.mutex.Unlock()
+
+	self.flush(events)
+}
+
+// take must be called with the mutex held.
+func (self *RateLimiter) take() bool {
+	now := self.now()
+	self.tokens += now.Sub(self.last).Minutes() * self.limit.PerMinute
+	if self.tokens > float64(self.limit.Burst) {
+		self.tokens = float64(self.limit.Burst)
+	}
+	self.last = now
+
+	if self.tokens < 1 {
+		return false
+	}
+	self.tokens--
+	return true
+}
+
+// wait is the time until the next token, must be called with the mutex held.
+func (self *RateLimiter) wait() time.Duration {
+	wait := time.Duration((1 - self.tokens) / self.limit.PerMinute * float64(time.Minute))
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (self *testClock) Now() time.Time {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.now
+}
+
+func (self *testClock) Advance(d time.Duration) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.now = self.now.Add(d)
+}
+
+// newTestRateLimiter has a bucket of 6 tokens a minute, one every 10 seconds.
+func newTestRateLimiter(t *testing.T, burst int) (*RateLimiter, *testClock, *[][]*AlertEvent) {
+	clock := &testClock{now: time.Unix(1600000000, 0)}
+	flushed := &[][]*AlertEvent{}
+
+	limiter := NewRateLimiter(RateLimit{PerMinute: 6, Burst: burst}, func(events []*AlertEvent) {
+		*flushed = append(*flushed, events)
+	})
+	limiter.now = clock.Now
+	limiter.last = clock.Now()
+
+	t.Cleanup(func() {
+		limiter.mutex.Lock()
+		if limiter.timer != nil {
+			limiter.timer.Stop()
+		}
+		limiter.mutex.Unlock()
+	})
+	return limiter, clock, flushed
+}
+
+func TestRateLimiterBucket(t *testing.T) {
+	limiter, clock, _ := newTestRateLimiter(t, 2)
+
+	steps := []struct {
+		advance time.Duration
+		want    bool
+	}{
+		{0, true},
+		{0, true},
+		{0, false},
+		{5 * time.Second, false},
+		{5 * time.Second, true},
+		{0, false},
+		// Refills up to the burst only
+		{time.Hour, true},
+		{0, true},
+		{0, false},
+	}
+
+	for i, step := range steps {
+		clock.Advance(step.advance)
+		if got := limiter.Allow(); got != step.want {
+			t.Errorf("step %d: allow %v, want %v", i, got, step.want)
+		}
+	}
+}
+
+func TestRateLimiterBurstDefault(t *testing.T) {
+	limiter, _, _ := newTestRateLimiter(t, 0)
+	if !limiter.Allow() || limiter.Allow() {
+		t.Error("burst 0 is not a bucket of 1")
+	}
+}
+
+func TestRateLimiterRelease(t *testing.T) {
+	limiter, clock, flushed := newTestRateLimiter(t, 1)
+	first, second := newNotifierEvent(), newNotifierEvent()
+
+	limiter.Allow()
+	limiter.Suppress(first)
+	limiter.Suppress(second)
+
+	limiter.mutex.Lock()
+	wait := limiter.wait()
+	scheduled := limiter.timer != nil
+	limiter.mutex.Unlock()
+	if wait != 10*time.Second || !scheduled {
+		t.Fatalf("wait %v, scheduled %v", wait, scheduled)
+	}
+
+	limiter.release()
+	if len(*flushed) != 0 {
+		t.Fatalf("flushed without a token")
+	}
+
+	// Held events go first, a free token does not let new ones pass them
+	clock.Advance(10 * time.Second)
+	if limiter.Allow() {
+		t.Fatal("allowed while holding events back")
+	}
+
+	limiter.release()
+	if len(*flushed) != 1 || len((*flushed)[0]) != 2 || (*flushed)[0][0] != first || (*flushed)[0][1] != second {
+		t.Fatalf("flushed %v", *flushed)
+	}
+	if limiter.timer != nil || len(limiter.suppressed) != 0 {
+		t.Error("release kept its state")
+	}
+
+	// The flush took the token
+	if limiter.Allow() {
+		t.Error("allowed right after the release")
+	}
+	clock.Advance(10 * time.Second)
+	if !limiter.Allow() {
+		t.Error("not allowed after a refill")
+	}
+}
+
+// Suppressed groups are folded with single events into one message.
+func TestSendSuppressedFoldsGroups(t *testing.T) {
+	stub := newStubServer(t, http.StatusOK)
+	items := []WebHookItem{{Name: "hook", Type: NOTIFIER_TYPE_WEB_HOOK, DataType: "json", EndPoint: stub.URL, Data: map[string]interface{}{
+		"kind":    "{{.Kind}}",
+		"size":    "{{len .Group}}",
+		"content": "{{.Content}}",
+	}}}
+
+	old := dq
+	dq = newTestDeliveryQueue(t, items)
+	t.Cleanup(func() { dq = old })
+
+	a, b, c := newNotifierEvent(), newNotifierEvent(), newNotifierEvent()
+	a.Alert.Key, b.Alert.Key, c.Alert.Key = "A", "B", "C"
+
+	hook := &WebHook{isEnabled: true, items: items}
+	hook.sendSuppressed(&hook.items[0], []*AlertEvent{NewGroupEvent([]*AlertEvent{a, b}), c})
+
+	waitFor(t, "suppressed delivery", func() bool {
+		stub.mutex.Lock()
+		defer stub.mutex.Unlock()
+		return stub.requests == 1
+	})
+
+	body := stub.decoded(t)
+	if body["kind"] != ALERT_EVENT_SUPPRESSED || body["size"] != "3" || !strings.Contains(body["content"].(string), "3 more alerts") {
+		t.Errorf("body %v", body)
+	}
+}
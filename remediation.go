@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	REMEDIATION_RESULT_RUNNING   = "running"
+	REMEDIATION_RESULT_SUCCEEDED = "succeeded"
+	REMEDIATION_RESULT_FAILED    = "failed"
+)
+
+// Remediator runs the actions of config on failing items of this node,
+// at most MaxAttempts times a failure with CooldownSeconds between attempts
+// and MaxPerHour runs over all items of an action.
+// Results go to the master with the items and end up in alerts and incidents.
+type Remediator struct {
+	mutex   sync.Mutex
+	actions []*RemediationAction
+	states  map[string]*remediationState
+}
+
+type RemediationAction struct {
+	Name string `json:"name"`
+	AlertMatcher
+
+	Command         string            `json:"command"`
+	Args            []string          `json:"args"`
+	Env             map[string]string `json:"env"`
+	TimeoutSeconds  int               `json:"timeout_seconds"`
+	MaxAttempts     int               `json:"max_attempts"`
+	CooldownSeconds int               `json:"cooldown_seconds"`
+	MaxPerHour      int               `json:"max_per_hour"`
+
+	runs []time.Time
+}
+
+type RemediationResult struct {
+	Action   string    `json:"action"`
+	Attempt  int       `json:"attempt"`
+	Result   string    `json:"result"`
+	ExitCode int       `json:"exit_code"`
+	Output   string    `json:"output,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+}
+
+type remediationState struct {
+	attempts  int
+	running   bool
+	lastRunAt time.Time
+	result    *RemediationResult
+	reported  bool
+}
+
+func (self *Remediator) Init() error {
+	self.states = make(map[string]*remediationState)
+
+	b, err := ioutil.ReadFile(REMEDIATION_CONFIG_JSON)
+	if err != nil {
+		LogFatal("Can not read %s file (%v).", REMEDIATION_CONFIG_JSON, err)
+		return err
+	}
+
+	if err := json.Unmarshal(b, &self.actions); err != nil {
+		LogFatal("Error on %s file unmarshal (%v).", REMEDIATION_CONFIG_JSON, err)
+		return err
+	}
+
+	for i, v := range self.actions {
+		if v.Name == "" {
+			v.Name = fmt.Sprintf("remediation%d", i)
+		}
+		if v.Command == "" {
+			err := fmt.Errorf("remediation %s needs command", v.Name)
+			LogFatal("Error on %s file (%v).", REMEDIATION_CONFIG_JSON, err)
+			return err
+		}
+
+		if v.TimeoutSeconds <= 0 {
+			v.TimeoutSeconds = REMEDIATION_TIMEOUT_SECONDS
+		}
+		if v.MaxAttempts <= 0 {
+			v.MaxAttempts = REMEDIATION_MAX_ATTEMPTS
+		}
+		if v.CooldownSeconds <= 0 {
+			v.CooldownSeconds = REMEDIATION_COOLDOWN_SECONDS
+		}
+		if v.MaxPerHour <= 0 {
+			v.MaxPerHour = REMEDIATION_MAX_PER_HOUR
+		}
+	}
+
+	LogInfo("Remediator has loaded %d actions.", len(self.actions))
+	return nil
+}
+
+// Check starts the actions of failing items of a node report and puts
+// the latest result of each action on the items, before the report is sent.
+func (self *Remediator) Check(node *NodeData) {
+	if self == nil {
+		return
+	}
+
+	now := time.Now()
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for _, x := range AlertItems(node, "") {
+		alert := x.NewAlert(node)
+
+		var results []*RemediationResult
+		for _, action := range self.actions {
+			if !action.Match(alert) {
+				continue
+			}
+
+			key := action.Name + "/" + alert.Key
+			state := self.states[key]
+			if state == nil {
+				state = &remediationState{reported: true}
+				self.states[key] = state
+			}
+
+			if !x.IsProblem {
+				state.attempts = 0
+			} else if self.ready(action, state, alert.Key, now) {
+				state.attempts++
+				state.running = true
+				state.lastRunAt = now
+				state.result = &RemediationResult{
+					Action:   action.Name,
+					Attempt:  state.attempts,
+					Result:   REMEDIATION_RESULT_RUNNING,
+					StartsAt: now,
+				}
+				action.runs = append(action.runs, now)
+
+				stdin, _ := json.Marshal(x.Item)
+				go self.run(action, state, alert, *state.result, stdin)
+			}
+
+			if state.result != nil {
+				results = append(results, state.result)
+				state.reported = true
+			}
+		}
+		x.State.Remediations = results
+	}
+}
+
+// ready must be called with the mutex held.
+func (self *Remediator) ready(action *RemediationAction, state *remediationState, key string, now time.Time) bool {
+	// A result is reported once before the next attempt replaces it
+	if state.running || !state.reported || state.attempts >= action.MaxAttempts {
+		return false
+	}
+	if now.Sub(state.lastRunAt) < time.Second*time.Duration(action.CooldownSeconds) {
+		return false
+	}
+
+	n := 0
+	for n < len(action.runs) && now.Sub(action.runs[n]) >= time.Hour {
+		n++
+	}
+	action.runs = action.runs[n:]
+	if len(action.runs) >= action.MaxPerHour {
+		LogDebug("Remediation %s of %s over %d runs an hour", action.Name, key, action.MaxPerHour)
+		return false
+	}
+	return true
+}
+
+func (self *Remediator) run(action *RemediationAction, state *remediationState, alert *Alert, result RemediationResult, stdin []byte) {
+	LogInfo("Remediation %s of %s attempt %d/%d", action.Name, alert.Key, result.Attempt, action.MaxAttempts)
+
+	env := os.Environ()
+	for k, v := range action.Env {
+		env = append(env, k+"="+v)
+	}
+	env = append(env,
+		"ASM_NODE_NAME="+alert.NodeName,
+		"ASM_NODE_IP="+alert.NodeIpAddr,
+		"ASM_CHECK_TYPE="+alert.CheckType,
+		"ASM_ITEM_ID="+alert.ItemID,
+		"ASM_ITEM_NAME="+alert.ItemName,
+		"ASM_SEVERITY="+alert.Severity,
+		"ASM_ATTEMPT="+strconv.Itoa(result.Attempt),
+	)
+
+	code, output, err := RunCommand(action.Command, action.Args, env, stdin, time.Second*time.Duration(action.TimeoutSeconds))
+	result.EndsAt = time.Now()
+	result.ExitCode = code
+	result.Output = output
+	result.Result = REMEDIATION_RESULT_SUCCEEDED
+	if err != nil {
+		result.Result = REMEDIATION_RESULT_FAILED
+		result.Error = err.Error()
+	}
+
+	LogInfo("Remediation %s of %s attempt %d %s (%v)", action.Name, alert.Key, result.Attempt, result.Result, err)
+
+	self.mutex.Lock()
+	state.running = false
+	state.result = &result
+	state.reported = false
+	self.mutex.Unlock()
+}
+
+// Remediations returns the remediation results reported with an item.
+func Remediations(item interface{}) []*RemediationResult {
+	switch item := item.(type) {
+	case *HeartbeatItem:
+		return item.Remediations
+	case *PingItem:
+		return item.Remediations
+	case *HDDItem:
+		return item.Remediations
+	}
+	return nil
+}
+
+func (self *RemediationResult) String() string {
+	s := fmt.Sprintf("%s attempt %d %s", self.Action, self.Attempt, self.Result)
+	if self.Error != "" {
+		s += " (" + self.Error + ")"
+	}
+	return s
+}
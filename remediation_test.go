@@ -0,0 +1,123 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRemediatorReady(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name  string
+		state remediationState
+		runs  []time.Time
+		want  bool
+	}{
+		{"first", remediationState{reported: true}, nil, true},
+		{"running", remediationState{reported: true, running: true}, nil, false},
+		{"not reported", remediationState{attempts: 1, lastRunAt: now.Add(-time.Hour)}, nil, false},
+		{"max attempts", remediationState{attempts: 2, reported: true, lastRunAt: now.Add(-time.Hour)}, nil, false},
+		{"cooldown", remediationState{attempts: 1, reported: true, lastRunAt: now.Add(-time.Second * 59)}, nil, false},
+		{"after cooldown", remediationState{attempts: 1, reported: true, lastRunAt: now.Add(-time.Second * 60)}, nil, true},
+		{"per hour", remediationState{reported: true}, []time.Time{now.Add(-time.Minute * 50), now.Add(-time.Minute * 30), now.Add(-time.Minute)}, false},
+		{"runs over an hour ago", remediationState{reported: true}, []time.Time{now.Add(-time.Minute * 61), now.Add(-time.Minute * 30), now.Add(-time.Minute)}, true},
+	}
+
+	remediator := &Remediator{}
+	for _, test := range tests {
+		action := &RemediationAction{Name: "fix", MaxAttempts: 2, CooldownSeconds: 60, MaxPerHour: 3, runs: test.runs}
+		if got := remediator.ready(action, &test.state, "DB1/ping/8.8.8.8", now); got != test.want {
+			t.Errorf("%s: ready %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	action := &RemediationAction{MaxAttempts: 1, MaxPerHour: 3, runs: []time.Time{now.Add(-time.Minute * 61), now.Add(-time.Minute)}}
+	remediator.ready(action, &remediationState{reported: true}, "", now)
+	if len(action.runs) != 1 {
+		t.Errorf("%d runs kept, want the last hour only", len(action.runs))
+	}
+}
+
+func newTestRemediator(maxAttempts int) *Remediator {
+	return &Remediator{
+		states: make(map[string]*remediationState),
+		actions: []*RemediationAction{{
+			Name:            "fix",
+			AlertMatcher:    AlertMatcher{CheckTypes: []string{CHECK_TYPE_PING}},
+			Command:         "true",
+			TimeoutSeconds:  10,
+			MaxAttempts:     maxAttempts,
+			CooldownSeconds: 60,
+			MaxPerHour:      10,
+		}},
+	}
+}
+
+func (self *Remediator) state(key string) remediationState {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return *self.states[key]
+}
+
+// checkPing runs a check of a node with one ping item and returns the reported results.
+func (self *Remediator) checkPing(online bool) []*RemediationResult {
+	node := newPingNode("DB1", "8.8.8.8", online)
+	self.Check(node)
+	return node.PingItems[0].Remediations
+}
+
+func TestRemediatorAttempts(t *testing.T) {
+	remediator := newTestRemediator(1)
+	key := "fix/DB1/ping/8.8.8.8"
+
+	results := remediator.checkPing(false)
+	if len(results) != 1 || results[0].Result != REMEDIATION_RESULT_RUNNING || results[0].Attempt != 1 {
+		t.Fatalf("results %+v", results)
+	}
+	waitFor(t, "remediation run", func() bool { return !remediator.state(key).running })
+
+	// The result is reported once before any next attempt
+	results = remediator.checkPing(false)
+	if len(results) != 1 || results[0].Result != REMEDIATION_RESULT_SUCCEEDED || results[0].ExitCode != 0 {
+		t.Fatalf("results %+v", results)
+	}
+	if state := remediator.state(key); state.attempts != 1 || !state.reported {
+		t.Errorf("state %+v", state)
+	}
+
+	// Max attempts reached, the last result stays
+	results = remediator.checkPing(false)
+	if state := remediator.state(key); state.attempts != 1 || len(results) != 1 || results[0].Attempt != 1 {
+		t.Errorf("state %+v, results %+v", state, results)
+	}
+}
+
+// A recovered item gets its attempts again on its next failure.
+func TestRemediatorResetOnRecovery(t *testing.T) {
+	remediator := newTestRemediator(1)
+	key := "fix/DB1/ping/8.8.8.8"
+
+	remediator.checkPing(false)
+	waitFor(t, "remediation run", func() bool { return !remediator.state(key).running })
+	remediator.checkPing(false)
+
+	remediator.checkPing(true)
+	if state := remediator.state(key); state.attempts != 0 {
+		t.Fatalf("%d attempts after recovery", state.attempts)
+	}
+
+	// Still in cooldown of the last run
+	if results := remediator.checkPing(false); results[0].Result != REMEDIATION_RESULT_SUCCEEDED {
+		t.Fatalf("ran again in cooldown %+v", results)
+	}
+
+	remediator.mutex.Lock()
+	remediator.states[key].lastRunAt = time.Now().Add(-time.Minute)
+	remediator.mutex.Unlock()
+
+	results := remediator.checkPing(false)
+	if len(results) != 1 || results[0].Result != REMEDIATION_RESULT_RUNNING || results[0].Attempt != 1 {
+		t.Errorf("results %+v after recovery", results)
+	}
+	waitFor(t, "remediation run", func() bool { return !remediator.state(key).running })
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	REPORT_DAILY  = "daily"
+	REPORT_WEEKLY = "weekly"
+)
+
+// Reporter sends daily and weekly summaries of uptime, incidents, slow
+// ping targets, full disks and flapping items through the web hooks.
+// Samples of each report are collected from reports of nodes until it is sent.
+type Reporter struct {
+	mutex     sync.Mutex
+	schedules map[string]*Cron
+	location  *time.Location
+	windows   map[string]*ReportWindow
+}
+
+type ReportWindow struct {
+	Since   time.Time
+	Samples map[string]*ReportSample
+}
+
+type ReportSample struct {
+	Node      string
+	CheckType string
+	Item      string
+	RTTSum    int64
+	RTTCount  int64
+	RTTMax    int64
+	Usage     float64
+	Free      string
+	Total     string
+	Flapping  bool
+}
+
+// Report is the data of "report.body" message.
+type Report struct {
+	Title        string
+	Since        time.Time
+	Until        time.Time
+	Uptime       []ReportUptime
+	Incidents    []*Incident
+	SlowestPings []ReportPing
+	FullestDisks []ReportDisk
+	Flapping     []ReportItem
+}
+
+type ReportItem struct {
+	Node      string
+	CheckType string
+	Item      string
+}
+
+type ReportUptime struct {
+	ReportItem
+	Percent float64
+}
+
+type ReportPing struct {
+	ReportItem
+	AvgRTT float64
+	MaxRTT int64
+}
+
+type ReportDisk struct {
+	ReportItem
+	Usage float64
+	Free  string
+	Total string
+}
+
+func (self *Reporter) Init() error {
+	self.schedules = make(map[string]*Cron)
+	self.windows = make(map[string]*ReportWindow)
+
+	self.location = time.Local
+	if REPORT_TIMEZONE != "" {
+		location, err := time.LoadLocation(REPORT_TIMEZONE)
+		if err != nil {
+			LogFatal("Error on report timezone %s (%v).", REPORT_TIMEZONE, err)
+			return err
+		}
+		self.location = location
+	}
+
+	for name, spec := range map[string]string{REPORT_DAILY: REPORT_DAILY_SCHEDULE, REPORT_WEEKLY: REPORT_WEEKLY_SCHEDULE} {
+		if spec == "" {
+			continue
+		}
+
+		cron, err := ParseCron(spec)
+		if err != nil {
+			LogFatal("Error on %s report schedule (%v).", name, err)
+			return err
+		}
+		self.schedules[name] = cron
+		self.windows[name] = &ReportWindow{Since: time.Now(), Samples: make(map[string]*ReportSample)}
+	}
+
+	for _, v := range REPORT_HOOKS {
+		if wh.Item(v) == nil {
+			err := fmt.Errorf("unknown web hook %s", v)
+			LogFatal("Error on report hooks (%v).", err)
+			return err
+		}
+	}
+
+	LogInfo("Reporter has loaded %d schedules.", len(self.schedules))
+	return nil
+}
+
+func (self *Reporter) Run() {
+	for RUNNING {
+		now := time.Now()
+		<-time.After(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+
+		for _, name := range self.due(time.Now()) {
+			self.Send(name)
+		}
+	}
+}
+
+// due returns the reports scheduled on the minute of now in REPORT_TIMEZONE.
+func (self *Reporter) due(now time.Time) []string {
+	now = now.In(self.location)
+
+	var names []string
+	for name, cron := range self.schedules {
+		if cron.Match(now) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Sample collects the items of a node report into every report window.
+func (self *Reporter) Sample(node *NodeData) {
+	if self == nil {
+		return
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for _, x := range AlertItems(node, "") {
+		key := x.NewAlert(node).Key
+		for _, window := range self.windows {
+			sample := window.Samples[key]
+			if sample == nil {
+				sample = &ReportSample{Node: node.Name, CheckType: x.CheckType, Item: x.Name}
+				window.Samples[key] = sample
+			}
+
+			if x.State.IsFlapping {
+				sample.Flapping = true
+			}
+
+			switch item := x.Item.(type) {
+			case *PingItem:
+				if item.IsOnline {
+					sample.RTTSum += item.LastRTT
+					sample.RTTCount++
+					if item.LastRTT > sample.RTTMax {
+						sample.RTTMax = item.LastRTT
+					}
+				}
+			case *HDDItem:
+				if item.Usage >= sample.Usage {
+					sample.Usage = item.Usage
+					sample.Free = item.Free
+					sample.Total = item.Total
+				}
+			}
+		}
+	}
+}
+
+// Send builds a report of the window and starts a new window.
+func (self *Reporter) Send(name string) {
+	now := time.Now()
+
+	self.mutex.Lock()
+	window := self.windows[name]
+	self.windows[name] = &ReportWindow{Since: now, Samples: make(map[string]*ReportSample)}
+	self.mutex.Unlock()
+
+	if window == nil {
+		return
+	}
+
+	LogInfo("Report %s from %s", name, window.Since.Format(time.RFC3339))
+	data := self.build(window, now)
+
+	for i := range wh.items {
+		item := &wh.items[i]
+		if len(REPORT_HOOKS) > 0 {
+			if !containsString(REPORT_HOOKS, item.Name) {
+				continue
+			}
+		} else if item.EscalationOnly || !item.IsGroupable() {
+			continue
+		}
+
+		catalog := GetCatalog(item.Language)
+		report := *data
+		report.Title = catalog.Message("report."+name, nil)
+
+		event := &AlertEvent{
+			Kind: ALERT_EVENT_REPORT,
+			Time: now,
+			Alert: Alert{
+				Key:      "report/" + name,
+				ItemID:   name,
+				ItemName: report.Title,
+				StartsAt: window.Since,
+				EndsAt:   now,
+			},
+		}
+		wh.Send(item, event, catalog.Message("report.body", &report))
+	}
+}
+
+func (self *Reporter) build(window *ReportWindow, until time.Time) *Report {
+	report := &Report{
+		Since:     window.Since,
+		Until:     until,
+		Incidents: inc.Between(window.Since, until),
+	}
+
+	// Downtime of each alert key from incidents of the window
+	downtime := make(map[string]time.Duration)
+	for _, v := range report.Incidents {
+		start, end := v.StartsAt, v.EndsAt
+		if start.Before(window.Since) {
+			start = window.Since
+		}
+		if end.IsZero() || end.After(until) {
+			end = until
+		}
+		if end.After(start) {
+			downtime[v.Key] += end.Sub(start)
+		}
+	}
+
+	period := until.Sub(window.Since)
+	for key, v := range window.Samples {
+		item := ReportItem{Node: v.Node, CheckType: v.CheckType, Item: v.Item}
+
+		percent := 100.0
+		if period > 0 {
+			percent = 100 * (1 - float64(downtime[key])/float64(period))
+		}
+		report.Uptime = append(report.Uptime, ReportUptime{item, percent})
+
+		if v.RTTCount > 0 {
+			report.SlowestPings = append(report.SlowestPings, ReportPing{item, float64(v.RTTSum) / float64(v.RTTCount), v.RTTMax})
+		}
+		if v.CheckType == CHECK_TYPE_HDD {
+			report.FullestDisks = append(report.FullestDisks, ReportDisk{item, v.Usage, v.Free, v.Total})
+		}
+		if v.Flapping {
+			report.Flapping = append(report.Flapping, item)
+		}
+	}
+
+	sort.Slice(report.Uptime, func(i, j int) bool {
+		if report.Uptime[i].Percent != report.Uptime[j].Percent {
+			return report.Uptime[i].Percent < report.Uptime[j].Percent
+		}
+		return report.Uptime[i].Node+report.Uptime[i].Item < report.Uptime[j].Node+report.Uptime[j].Item
+	})
+	sort.Slice(report.SlowestPings, func(i, j int) bool {
+		return report.SlowestPings[i].AvgRTT > report.SlowestPings[j].AvgRTT
+	})
+	sort.Slice(report.FullestDisks, func(i, j int) bool {
+		return report.FullestDisks[i].Usage > report.FullestDisks[j].Usage
+	})
+	sort.Slice(report.Flapping, func(i, j int) bool {
+		return report.Flapping[i].Node+report.Flapping[i].Item < report.Flapping[j].Node+report.Flapping[j].Item
+	})
+
+	if REPORT_TOP > 0 {
+		if len(report.SlowestPings) > REPORT_TOP {
+			report.SlowestPings = report.SlowestPings[:REPORT_TOP]
+		}
+		if len(report.FullestDisks) > REPORT_TOP {
+			report.FullestDisks = report.FullestDisks[:REPORT_TOP]
+		}
+	}
+	return report
+}
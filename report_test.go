@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestReporter(t *testing.T, timezone string, daily string, weekly string) *Reporter {
+	oldTz, oldDaily, oldWeekly, oldHooks := REPORT_TIMEZONE, REPORT_DAILY_SCHEDULE, REPORT_WEEKLY_SCHEDULE, REPORT_HOOKS
+	t.Cleanup(func() {
+		REPORT_TIMEZONE, REPORT_DAILY_SCHEDULE, REPORT_WEEKLY_SCHEDULE, REPORT_HOOKS = oldTz, oldDaily, oldWeekly, oldHooks
+	})
+	REPORT_TIMEZONE, REPORT_DAILY_SCHEDULE, REPORT_WEEKLY_SCHEDULE, REPORT_HOOKS = timezone, daily, weekly, nil
+
+	reporter := &Reporter{}
+	if err := reporter.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return reporter
+}
+
+func TestReporterDue(t *testing.T) {
+	setTestQueuedHooks(t)
+	reporter := newTestReporter(t, "Asia/Seoul", "0 9 * * *", "0 9 * * 1")
+
+	// 09:00 in Seoul is 00:00 UTC, 2024-03-11 is a monday there
+	tests := []struct {
+		now  time.Time
+		want string
+	}{
+		{time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), "daily weekly"},
+		{time.Date(2024, 3, 11, 0, 0, 59, 0, time.UTC), "daily weekly"},
+		{time.Date(2024, 3, 12, 0, 0, 0, 0, time.UTC), "daily"},
+		{time.Date(2024, 3, 11, 0, 1, 0, 0, time.UTC), ""},
+		{time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC), ""},
+		{time.Date(2024, 3, 10, 15, 0, 0, 0, time.FixedZone("", -9*3600)), "daily weekly"},
+	}
+
+	for _, test := range tests {
+		if got := strings.Join(reporter.due(test.now), " "); got != test.want {
+			t.Errorf("%v: due %q, want %q", test.now, got, test.want)
+		}
+	}
+
+	// An empty schedule disables its report
+	reporter = newTestReporter(t, "", "0 9 * * *", "")
+	if _, ok := reporter.windows[REPORT_WEEKLY]; ok || reporter.location != time.Local {
+		t.Errorf("windows %v in %v", reporter.windows, reporter.location)
+	}
+
+	REPORT_TIMEZONE = "Nowhere/City"
+	if err := (&Reporter{}).Init(); err == nil {
+		t.Error("unknown timezone loaded")
+	}
+	REPORT_TIMEZONE, REPORT_DAILY_SCHEDULE = "", "0 9 * *"
+	if err := (&Reporter{}).Init(); err == nil {
+		t.Error("invalid schedule loaded")
+	}
+}
+
+func TestReporterUptime(t *testing.T) {
+	oldInc, oldTop := inc, REPORT_TOP
+	t.Cleanup(func() { inc, REPORT_TOP = oldInc, oldTop })
+	inc = newTestIncidents(t)
+	REPORT_TOP = 1
+
+	until := time.Date(2024, 3, 13, 10, 0, 0, 0, time.UTC)
+	since := until.Add(-10 * time.Hour)
+
+	incident := func(key string, startsAt time.Time, endsAt time.Time) {
+		id := inc.Open(&Alert{Key: key, StartsAt: startsAt})
+		if !endsAt.IsZero() {
+			inc.Close(id, endsAt)
+		}
+	}
+	// Down since before the window, for an hour in it
+	incident("A/ping/1", since.Add(-time.Hour), since.Add(time.Hour))
+	// An hour, then still down for the last two
+	incident("B/ping/1", since.Add(time.Hour), since.Add(2*time.Hour))
+	incident("B/ping/1", until.Add(-2*time.Hour), time.Time{})
+	// Over before the window
+	incident("C/hdd/sda", since.Add(-2*time.Hour), since.Add(-time.Hour))
+	// Not sampled
+	incident("D/ping/1", since, until)
+
+	window := &ReportWindow{Since: since, Samples: map[string]*ReportSample{
+		"A/ping/1":  {Node: "A", CheckType: CHECK_TYPE_PING, Item: "1", RTTSum: 30, RTTCount: 3, RTTMax: 20},
+		"B/ping/1":  {Node: "B", CheckType: CHECK_TYPE_PING, Item: "1", RTTSum: 100, RTTCount: 2, RTTMax: 60, Flapping: true},
+		"C/hdd/sda": {Node: "C", CheckType: CHECK_TYPE_HDD, Item: "sda", Usage: 91.5, Free: "8G", Total: "100G"},
+	}}
+	report := (&Reporter{}).build(window, until)
+
+	want := []struct {
+		node    string
+		percent float64
+	}{{"B", 70}, {"A", 90}, {"C", 100}}
+	if len(report.Uptime) != len(want) {
+		t.Fatalf("uptime %v", report.Uptime)
+	}
+	for i, v := range want {
+		if got := report.Uptime[i]; got.Node != v.node || math.Abs(got.Percent-v.percent) > 1e-9 {
+			t.Errorf("uptime %d: %s %v, want %s %v", i, got.Node, got.Percent, v.node, v.percent)
+		}
+	}
+
+	if len(report.Incidents) != 4 {
+		t.Errorf("%d incidents, want 4", len(report.Incidents))
+	}
+	if len(report.SlowestPings) != 1 || report.SlowestPings[0].Node != "B" || report.SlowestPings[0].AvgRTT != 50 || report.SlowestPings[0].MaxRTT != 60 {
+		t.Errorf("slowest pings %v", report.SlowestPings)
+	}
+	if len(report.FullestDisks) != 1 || report.FullestDisks[0].Usage != 91.5 || report.FullestDisks[0].Free != "8G" {
+		t.Errorf("fullest disks %v", report.FullestDisks)
+	}
+	if len(report.Flapping) != 1 || report.Flapping[0].Node != "B" {
+		t.Errorf("flapping %v", report.Flapping)
+	}
+}
+
+// Reports go to groupable hooks, or those of HOOKS, and are never rate limited.
+func TestReporterSend(t *testing.T) {
+	setTestQueuedHooks(t,
+		WebHookItem{Name: "chat", Type: NOTIFIER_TYPE_SLACK, EndPoint: "http://127.0.0.1:1"},
+		WebHookItem{Name: "pager", Type: NOTIFIER_TYPE_SLACK, EndPoint: "http://127.0.0.1:1", EscalationOnly: true},
+		WebHookItem{Name: "oncall", Type: NOTIFIER_TYPE_PAGERDUTY, EndPoint: "http://127.0.0.1:1", RoutingKey: "key"},
+		WebHookItem{Name: "script", Type: NOTIFIER_TYPE_EXEC, Command: "true"},
+	)
+	reporter := newTestReporter(t, "", "0 9 * * *", "")
+
+	// The chat hook is over its limit
+	chat := wh.Item("chat")
+	chat.limiter = NewRateLimiter(RateLimit{PerMinute: 1, Burst: 1}, func([]*AlertEvent) {})
+	if !chat.limiter.Allow() || chat.limiter.Allow() {
+		t.Fatal("limiter not exhausted")
+	}
+
+	since := reporter.windows[REPORT_DAILY].Since
+	reporter.Send(REPORT_DAILY)
+
+	var got []string
+	for _, hook := range []string{"chat", "pager", "oncall", "script"} {
+		for _, v := range sent(hook) {
+			got = append(got, hook+" "+v)
+		}
+	}
+	if strings.Join(got, ",") != "chat report report/daily" {
+		t.Fatalf("sent %v", got)
+	}
+	if window := reporter.windows[REPORT_DAILY]; !window.Since.After(since) || len(window.Samples) != 0 {
+		t.Errorf("window %v not started over", window)
+	}
+
+	REPORT_HOOKS = []string{"script"}
+	reporter.Send(REPORT_DAILY)
+	if chat, script := sent("chat"), sent("script"); len(chat) != 0 || len(script) != 1 {
+		t.Errorf("chat got %v, script got %v", chat, script)
+	}
+
+	// Unknown and unscheduled reports are not sent
+	reporter.Send(REPORT_WEEKLY)
+	if script := sent("script"); len(script) != 0 {
+		t.Errorf("script got %v", script)
+	}
+}
+
+func TestReporterSendBody(t *testing.T) {
+	setTestQueuedHooks(t, WebHookItem{Name: "chat", Type: NOTIFIER_TYPE_SLACK, EndPoint: "http://127.0.0.1:1"})
+	reporter := newTestReporter(t, "", "0 9 * * *", "")
+	reporter.Sample(newPingNode("DB1", "8.8.8.8", true))
+	reporter.Send(REPORT_DAILY)
+
+	d := <-dq.queues["chat"]
+	b, _ := json.Marshal(d.Payload)
+	if !strings.Contains(string(b), "DB1") {
+		t.Errorf("payload %s", b)
+	}
+}
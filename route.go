@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path"
+)
+
+// AlertMatcher selects alerts, an empty list matches anything.
+// Nodes and items accept glob patterns, items match on name or id.
+type AlertMatcher struct {
+	CheckTypes []string `json:"check_types"`
+	Nodes      []string `json:"nodes"`
+	Severities []string `json:"severities"`
+	Items      []string `json:"items"`
+}
+
+// WebHookRoute selects alerts for a web hook, check types default to DefaultCheckTypes.
+// Escalation names the escalation policy started by a firing alert of the route.
+type WebHookRoute struct {
+	AlertMatcher
+	Escalation string `json:"escalation"`
+}
+
+// DefaultCheckTypes are the check types enabled by IS_ENABLE_* of [WEB_HOOK].
+func DefaultCheckTypes() []string {
+	var types []string
+	if IS_WEB_HOOK_HB_ENABLE {
+		types = append(types, CHECK_TYPE_HEARTBEAT)
+	}
+	if IS_WEB_HOOK_PING_ENABLE {
+		types = append(types, CHECK_TYPE_PING)
+	}
+	if IS_WEB_HOOK_HDD_ENABLE {
+		types = append(types, CHECK_TYPE_HDD)
+	}
+	return types
+}
+
+func (self *AlertMatcher) Match(alert *Alert) bool {
+	return matchAny(self.CheckTypes, alert.CheckType, true) &&
+		matchAny(self.Nodes, alert.NodeName, true) &&
+		matchAny(self.Severities, alert.Severity, true) &&
+		(matchAny(self.Items, alert.ItemName, true) || matchAny(self.Items, alert.ItemID, true))
+}
+
+// IsEmpty reports whether the matcher matches every alert.
+func (self *AlertMatcher) IsEmpty() bool {
+	return len(self.CheckTypes) == 0 && len(self.Nodes) == 0 && len(self.Severities) == 0 && len(self.Items) == 0
+}
+
+func (self *WebHookRoute) Match(alert *Alert) bool {
+	matcher := self.AlertMatcher
+	if len(matcher.CheckTypes) == 0 {
+		matcher.CheckTypes = DefaultCheckTypes()
+		if len(matcher.CheckTypes) == 0 {
+			return false
+		}
+	}
+	return matcher.Match(alert)
+}
+
+func matchAny(patterns []string, value string, emptyMatches bool) bool {
+	if len(patterns) == 0 {
+		return emptyMatches
+	}
+
+	for _, v := range patterns {
+		if ok, _ := path.Match(v, value); ok {
+			return true
+		}
+	}
+	return false
+}
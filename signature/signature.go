@@ -0,0 +1,85 @@
+// Package signature signs and verifies the bodies of outgoing web hooks.
+//
+// The header is "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">",
+// receivers should check it over the raw body before decoding it:
+//
+//	err := signature.Verify(secret, r.Header.Get(signature.Header), body, 5*time.Minute)
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const Header = "X-ASM-Signature"
+
+var (
+	ErrMalformed = errors.New("signature: malformed header")
+	ErrExpired   = errors.New("signature: timestamp out of tolerance")
+	ErrMismatch  = errors.New("signature: no matching signature")
+)
+
+// Sign returns the header value of body signed at timestamp.
+func Sign(secret []byte, timestamp int64, body []byte) string {
+	return "t=" + strconv.FormatInt(timestamp, 10) + ",v1=" + hex.EncodeToString(compute(secret, timestamp, body))
+}
+
+// Verify checks header against body, a zero tolerance skips the timestamp check.
+func Verify(secret []byte, header string, body []byte, tolerance time.Duration) error {
+	var timestamp int64 = -1
+	var signatures [][]byte
+
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return ErrMalformed
+		}
+
+		switch kv[0] {
+		case "t":
+			t, err := strconv.ParseInt(kv[1], 10, 64)
+			if err != nil {
+				return ErrMalformed
+			}
+			timestamp = t
+		case "v1":
+			sig, err := hex.DecodeString(kv[1])
+			if err != nil {
+				return ErrMalformed
+			}
+			signatures = append(signatures, sig)
+		}
+	}
+
+	if timestamp < 0 || len(signatures) == 0 {
+		return ErrMalformed
+	}
+
+	if tolerance > 0 {
+		age := time.Since(time.Unix(timestamp, 0))
+		if age > tolerance || age < -tolerance {
+			return ErrExpired
+		}
+	}
+
+	expected := compute(secret, timestamp, body)
+	for _, v := range signatures {
+		if hmac.Equal(v, expected) {
+			return nil
+		}
+	}
+	return ErrMismatch
+}
+
+func compute(secret []byte, timestamp int64, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,60 @@
+package signature
+
+import (
+	"testing"
+	"time"
+)
+
+var (
+	testSecret = []byte("secret")
+	testBody   = []byte(`{"a":1}`)
+)
+
+func TestSign(t *testing.T) {
+	want := "t=1600000000,v1=4e107d82910257d43758070322323c95b92af39939824d6610e2c9809a43b8d5"
+	if got := Sign(testSecret, 1600000000, testBody); got != want {
+		t.Errorf("header %q, want %q", got, want)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Now().Unix()
+	valid := Sign(testSecret, now, testBody)
+	old := Sign(testSecret, now-600, testBody)
+	future := Sign(testSecret, now+600, testBody)
+	rotated := Sign([]byte("old secret"), now, testBody)
+
+	tests := []struct {
+		name      string
+		secret    []byte
+		header    string
+		body      []byte
+		tolerance time.Duration
+		want      error
+	}{
+		{"round trip", testSecret, valid, testBody, 5 * time.Minute, nil},
+		{"spaces", testSecret, " " + valid[:12] + " , " + valid[13:], testBody, 5 * time.Minute, nil},
+		{"second signature", testSecret, rotated + "," + valid[13:], testBody, 5 * time.Minute, nil},
+		{"unknown key", testSecret, valid + ",v0=abc", testBody, 5 * time.Minute, nil},
+		{"empty", testSecret, "", testBody, 5 * time.Minute, ErrMalformed},
+		{"no equals", testSecret, valid + ",v1", testBody, 5 * time.Minute, ErrMalformed},
+		{"bad timestamp", testSecret, "t=abc," + valid[13:], testBody, 5 * time.Minute, ErrMalformed},
+		{"no timestamp", testSecret, valid[13:], testBody, 5 * time.Minute, ErrMalformed},
+		{"no signature", testSecret, valid[:12], testBody, 5 * time.Minute, ErrMalformed},
+		{"bad hex", testSecret, valid[:12] + ",v1=xyz", testBody, 5 * time.Minute, ErrMalformed},
+		{"tampered body", testSecret, valid, []byte(`{"a":2}`), 5 * time.Minute, ErrMismatch},
+		{"wrong secret", []byte("other"), valid, testBody, 5 * time.Minute, ErrMismatch},
+		{"old secret only", testSecret, rotated, testBody, 5 * time.Minute, ErrMismatch},
+		{"expired", testSecret, old, testBody, 5 * time.Minute, ErrExpired},
+		{"future", testSecret, future, testBody, 5 * time.Minute, ErrExpired},
+		{"no tolerance", testSecret, old, testBody, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(tt.secret, tt.header, tt.body, tt.tolerance); err != tt.want {
+				t.Fatalf("error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
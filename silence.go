@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Silences mute notifications of matching alerts for a while,
+// web hooks stay enabled and alerts keep their state.
+// Like maintenance, they mute alerts in AlertManager.check.
+type Silences struct {
+	mutex sync.Mutex
+	items []*Silence
+}
+
+type Silence struct {
+	ID string `json:"id"`
+	AlertMatcher
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	CreatedBy string    `json:"created_by"`
+	Comment   string    `json:"comment"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (self *Silences) Init() {
+	if b, err := ioutil.ReadFile(SILENCE_PATH); err == nil {
+		if err := json.Unmarshal(b, &self.items); err != nil {
+			LogFatal("Error on %s file unmarshal (%v).", SILENCE_PATH, err)
+		}
+	} else if !os.IsNotExist(err) {
+		LogFatal("Can not read %s file (%v).", SILENCE_PATH, err)
+	}
+
+	LogInfo("Silences has loaded %d silences.", len(self.items))
+}
+
+func (self *Silence) IsActive(now time.Time) bool {
+	return !now.Before(self.StartsAt) && now.Before(self.EndsAt)
+}
+
+// Find returns the active silence of an alert, nil if not silenced.
+func (self *Silences) Find(alert *Alert) *Silence {
+	if self == nil {
+		return nil
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	now := time.Now()
+	for _, v := range self.items {
+		if v.IsActive(now) && v.Match(alert) {
+			return v
+		}
+	}
+	return nil
+}
+
+// prune drops expired silences, must be called with the mutex held.
+func (self *Silences) prune() {
+	now := time.Now()
+	items := self.items[:0]
+	for _, v := range self.items {
+		if now.Before(v.EndsAt) {
+			items = append(items, v)
+		}
+	}
+	self.items = items
+}
+
+func (self *Silences) save() {
+	if err := SaveJson(SILENCE_PATH, self.items); err != nil {
+		LogFatal("Can not write %s file (%v).", SILENCE_PATH, err)
+	}
+}
+
+func (self *Silences) List(c *gin.Context) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.prune()
+	c.JSON(http.StatusOK, self.items)
+}
+
+func (self *Silences) Create(c *gin.Context) {
+	var silence Silence
+	if err := c.BindJSON(&silence); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "No arguments."})
+		return
+	}
+
+	now := time.Now()
+	if silence.StartsAt.IsZero() {
+		silence.StartsAt = now
+	}
+	if !silence.EndsAt.After(silence.StartsAt) || !silence.EndsAt.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ends_at must be after starts_at and now."})
+		return
+	}
+	if silence.CreatedBy == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "No created_by."})
+		return
+	}
+	// An empty matcher would mute every alert
+	if silence.IsEmpty() {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "No check_types, nodes, severities or items."})
+		return
+	}
+
+	silence.ID = NewID()
+	silence.CreatedAt = now
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.prune()
+	self.items = append(self.items, &silence)
+	self.save()
+
+	LogInfo("Silence %s created by %s until %s", silence.ID, silence.CreatedBy, silence.EndsAt.Format(time.RFC3339))
+	c.JSON(http.StatusOK, silence)
+}
+
+func (self *Silences) Delete(c *gin.Context) {
+	id := c.Param("id")
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for i, v := range self.items {
+		if v.ID == id {
+			self.items = append(self.items[:i], self.items[i+1:]...)
+			self.prune()
+			self.save()
+
+			LogInfo("Silence %s deleted", id)
+			c.JSON(http.StatusOK, v)
+			return
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"message": "No matching silence."})
+}
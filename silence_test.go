@@ -0,0 +1,141 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newPingNode(name string, ipAddr string, online bool) *NodeData {
+	return &NodeData{
+		Name:      name,
+		IpAddr:    "10.0.0.1",
+		PingItems: []*PingItem{{Name: "ping " + ipAddr, IpAddr: ipAddr, IsOnline: online}},
+	}
+}
+
+func setTestSilences(t *testing.T, items ...*Silence) {
+	old := sl
+	sl = &Silences{items: items}
+	t.Cleanup(func() { sl = old })
+}
+
+func TestSilencesFind(t *testing.T) {
+	now := time.Now()
+	setTestSilences(t,
+		&Silence{ID: "expired", AlertMatcher: AlertMatcher{Nodes: []string{"DB*"}}, StartsAt: now.Add(-time.Hour), EndsAt: now.Add(-time.Minute)},
+		&Silence{ID: "pending", AlertMatcher: AlertMatcher{Nodes: []string{"WEB*"}}, StartsAt: now.Add(time.Minute), EndsAt: now.Add(time.Hour)},
+		&Silence{ID: "db", AlertMatcher: AlertMatcher{Nodes: []string{"DB*"}, CheckTypes: []string{CHECK_TYPE_PING}}, StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Hour)},
+		&Silence{ID: "item", AlertMatcher: AlertMatcher{Items: []string{"10.0.0.*"}}, StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Hour)},
+	)
+
+	tests := []struct {
+		alert Alert
+		want  string
+	}{
+		{Alert{NodeName: "DB1", CheckType: CHECK_TYPE_PING, ItemID: "8.8.8.8"}, "db"},
+		{Alert{NodeName: "DB1", CheckType: CHECK_TYPE_HDD, ItemID: "/"}, ""},
+		{Alert{NodeName: "WEB1", CheckType: CHECK_TYPE_PING, ItemID: "8.8.8.8"}, ""},
+		{Alert{NodeName: "WEB1", CheckType: CHECK_TYPE_PING, ItemID: "10.0.0.2"}, "item"},
+	}
+
+	for _, test := range tests {
+		got := ""
+		if s := sl.Find(&test.alert); s != nil {
+			got = s.ID
+		}
+		if got != test.want {
+			t.Errorf("%s/%s/%s: silence %q, want %q", test.alert.NodeName, test.alert.CheckType, test.alert.ItemID, got, test.want)
+		}
+	}
+
+	var none *Silences
+	if none.Find(&Alert{}) != nil {
+		t.Error("nil silences found a silence")
+	}
+}
+
+// A silenced alert is muted like maintenance, so it fires once the silence
+// ends and resolves quietly if it never fired.
+func TestSilencedAlertFiresWhenSilenceEnds(t *testing.T) {
+	grouper := newTestGrouper(t)
+	old := ag
+	ag = grouper
+	t.Cleanup(func() { ag = old })
+
+	manager := &AlertManager{}
+	manager.Init()
+
+	silence := &Silence{ID: "s", AlertMatcher: AlertMatcher{Nodes: []string{"DB1"}}, StartsAt: time.Now().Add(-time.Minute), EndsAt: time.Now().Add(time.Hour)}
+	setTestSilences(t, silence)
+
+	manager.CheckPing(newPingNode("DB1", "8.8.8.8", false))
+	manager.CheckPing(newPingNode("DB2", "8.8.8.8", false))
+	if pending := grouper.pending(); len(pending) != 1 || pending["firing/DB2"] != 1 {
+		t.Fatalf("pending %v", pending)
+	}
+
+	sl.mutex.Lock()
+	silence.EndsAt = time.Now().Add(-time.Second)
+	sl.mutex.Unlock()
+
+	manager.CheckPing(newPingNode("DB1", "8.8.8.8", false))
+	if pending := grouper.pending(); pending["firing/DB1"] != 1 {
+		t.Fatalf("pending %v after the silence", pending)
+	}
+
+	// Silenced from ok to firing and back, the resolve is not notified either
+	sl.mutex.Lock()
+	silence.AlertMatcher.Nodes = []string{"DB3"}
+	silence.EndsAt = time.Now().Add(time.Hour)
+	sl.mutex.Unlock()
+
+	manager.CheckPing(newPingNode("DB3", "8.8.8.8", false))
+	manager.CheckPing(newPingNode("DB3", "8.8.8.8", true))
+	if pending := grouper.pending(); pending["firing/DB3"] != 0 || pending["resolved/DB3"] != 0 {
+		t.Errorf("pending %v for a silenced flap", pending)
+	}
+}
+
+func TestSilencesCreate(t *testing.T) {
+	SILENCE_PATH = filepath.Join(t.TempDir(), "silences.json")
+	setTestSilences(t)
+	gin.SetMode(gin.TestMode)
+
+	endsAt := time.Now().Add(time.Hour).Format(time.RFC3339)
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"nodes", `{"nodes": ["DB*"], "ends_at": "` + endsAt + `", "created_by": "ops"}`, http.StatusOK},
+		{"items", `{"items": ["10.0.0.*"], "ends_at": "` + endsAt + `", "created_by": "ops"}`, http.StatusOK},
+		{"empty matcher", `{"ends_at": "` + endsAt + `", "created_by": "ops"}`, http.StatusBadRequest},
+		{"empty lists", `{"nodes": [], "check_types": [], "ends_at": "` + endsAt + `", "created_by": "ops"}`, http.StatusBadRequest},
+		{"no created_by", `{"nodes": ["DB*"], "ends_at": "` + endsAt + `"}`, http.StatusBadRequest},
+		{"ended", `{"nodes": ["DB*"], "ends_at": "2020-01-01T00:00:00Z", "created_by": "ops"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/silences", strings.NewReader(tt.body))
+			sl.Create(c)
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d (%s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	if len(sl.items) != 2 {
+		t.Errorf("%d silences created, want 2", len(sl.items))
+	}
+	if sl.Find(&Alert{NodeName: "WEB1", CheckType: CHECK_TYPE_PING, ItemID: "8.8.8.8"}) != nil {
+		t.Error("an unmatched alert is silenced")
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+type TemplateEvent struct {
+	Kind      string       `json:"kind"`
+	CheckType string       `json:"check_type"`
+	Severity  string       `json:"severity"`
+	OldState  string       `json:"old_state"`
+	NewState  string       `json:"new_state"`
+	Node      TemplateNode `json:"node"`
+	ItemID    string       `json:"item_id"`
+	ItemName  string       `json:"item_name"`
+	Item      interface{}  `json:"item"`
+	StartsAt  time.Time    `json:"starts_at"`
+	EndsAt    time.Time    `json:"ends_at"`
+	Time      time.Time    `json:"time"`
+	Content   string       `json:"content"`
+
+	Labels       map[string]string    `json:"labels"`
+	Remediations []*RemediationResult `json:"remediations,omitempty"`
+	Group        []*TemplateEvent     `json:"group,omitempty"`
+}
+
+type TemplateNode struct {
+	Name   string `json:"name"`
+	IpAddr string `json:"ip_addr"`
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"jsonEscape": func(v string) (string, error) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(b[1 : len(b)-1]), nil
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"formatTime": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+}
+
+func NewTemplateEvent(event *AlertEvent, content string) *TemplateEvent {
+	var group []*TemplateEvent
+	for _, v := range event.Group {
+		group = append(group, NewTemplateEvent(v, ""))
+	}
+
+	// A group has no item of its own, an empty one keeps {{.Item.X}} rendering
+	item := event.Alert.Item
+	if item == nil && len(event.Group) > 0 {
+		item = emptyItem(event.Group[0].Alert.Item)
+	}
+
+	return &TemplateEvent{
+		Kind:      event.Kind,
+		CheckType: event.Alert.CheckType,
+		Severity:  event.Alert.Severity,
+		OldState:  event.OldState,
+		NewState:  event.NewState,
+		Node: TemplateNode{
+			Name:   event.Alert.NodeName,
+			IpAddr: event.Alert.NodeIpAddr,
+		},
+		ItemID:   event.Alert.ItemID,
+		ItemName: event.Alert.ItemName,
+		Item:     item,
+		StartsAt: event.Alert.StartsAt,
+		EndsAt:   event.Alert.EndsAt,
+		Time:     event.Time,
+		Content:  content,
+		Labels:   event.Alert.Labels,
+		Group:    group,
+
+		Remediations: event.Alert.Remediations,
+	}
+}
+
+// emptyItem is a zero item of the type of item.
+func emptyItem(item interface{}) interface{} {
+	switch item.(type) {
+	case *HeartbeatItem:
+		return &HeartbeatItem{}
+	case *PingItem:
+		return &PingItem{}
+	case *HDDItem:
+		return &HDDItem{}
+	}
+	return map[string]interface{}{}
+}
+
+// CompilePayload parses every string of a decoded JSON value as a template,
+// at any depth of maps and arrays. prepare rewrites a string before parsing.
+func CompilePayload(name string, v interface{}, prepare func(string) string) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		if prepare != nil {
+			v = prepare(v)
+		}
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		return template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(v)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, x := range v {
+			c, err := CompilePayload(name+"."+k, x, prepare)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = c
+		}
+		return m, nil
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, x := range v {
+			c, err := CompilePayload(fmt.Sprintf("%s[%d]", name, i), x, prepare)
+			if err != nil {
+				return nil, err
+			}
+			a[i] = c
+		}
+		return a, nil
+	}
+	return v, nil
+}
+
+// RenderPayload executes a compiled payload. Rendered strings stay leaves of
+// the payload, so marshalling it escapes them and they can not break the JSON.
+func RenderPayload(v interface{}, data interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case *template.Template:
+		var buf bytes.Buffer
+		if err := v.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		return buf.String(), nil
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, x := range v {
+			r, err := RenderPayload(x, data)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = r
+		}
+		return m, nil
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, x := range v {
+			r, err := RenderPayload(x, data)
+			if err != nil {
+				return nil, err
+			}
+			a[i] = r
+		}
+		return a, nil
+	}
+	return v, nil
+}
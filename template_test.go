@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func renderTestPayload(t *testing.T, data interface{}, event *TemplateEvent) interface{} {
+	var decoded interface{}
+	b, _ := json.Marshal(data)
+	json.Unmarshal(b, &decoded)
+
+	compiled, err := CompilePayload("data", decoded, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered, err := RenderPayload(compiled, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rendered
+}
+
+func TestRenderPayloadNested(t *testing.T) {
+	data := map[string]interface{}{
+		"text": "{{.Kind}} {{.ItemName}}",
+		"attachments": []interface{}{
+			map[string]interface{}{
+				"fields": []interface{}{"{{.Node.Name}}", "{{upper .Severity}}", "plain"},
+				"count":  3,
+				"short":  true,
+			},
+		},
+		"meta": map[string]interface{}{"rtt": "{{.Item.LastRTT}}", "none": nil},
+	}
+
+	rendered := renderTestPayload(t, data, NewTemplateEvent(newNotifierEvent(), ""))
+	b, _ := json.Marshal(rendered)
+	want := `{"attachments":[{"count":3,"fields":["MAIN","CRITICAL","plain"],"short":true}],"meta":{"none":null,"rtt":"12"},"text":"firing DNS"}`
+	if string(b) != want {
+		t.Errorf("rendered %s\nwant %s", b, want)
+	}
+}
+
+// Rendered strings are leaves of the payload, quotes and newlines can not break its JSON.
+func TestRenderPayloadEscaping(t *testing.T) {
+	content := "say \"hi\"\n\tand } { \\ </script>"
+	data := map[string]interface{}{"text": "{{.Content}}", "escaped": "\"{{jsonEscape .Content}}\""}
+
+	rendered := renderTestPayload(t, data, &TemplateEvent{Content: content})
+	b, err := json.Marshal(rendered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var back map[string]string
+	if err := json.Unmarshal(b, &back); err != nil {
+		t.Fatalf("invalid JSON %s (%v)", b, err)
+	}
+	if back["text"] != content {
+		t.Errorf("text %q, want %q", back["text"], content)
+	}
+
+	var escaped string
+	if err := json.Unmarshal([]byte(back["escaped"]), &escaped); err != nil || escaped != content {
+		t.Errorf("jsonEscape %q (%v)", back["escaped"], err)
+	}
+}
+
+func TestCompilePayloadRejectsInvalidTemplate(t *testing.T) {
+	for _, v := range []interface{}{
+		"{{.Kind",
+		map[string]interface{}{"a": []interface{}{"ok", "{{if}}"}},
+		"{{unknownFunc .Kind}}",
+	} {
+		if _, err := CompilePayload("data", v, nil); err == nil {
+			t.Errorf("%v compiled", v)
+		}
+	}
+
+	WEB_HOOK_CONFIG_JSON = filepath.Join(t.TempDir(), "web_hooks.json")
+	config := `[{"name": "ops", "type": "webhook", "end_point": "http://127.0.0.1:1", "data": {"text": "{{.Kind"}}]`
+	if err := ioutil.WriteFile(WEB_HOOK_CONFIG_JSON, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&WebHook{}).Init(); err == nil {
+		t.Error("web hook with an invalid template loaded")
+	}
+}
+
+// Item templates of single alerts render for groups of them too.
+func TestTemplateEventGroupItem(t *testing.T) {
+	a, b := newNotifierEvent(), newNotifierEvent()
+	b.Alert.Key = "MAIN/ping/1.1.1.1"
+	group := NewGroupEvent([]*AlertEvent{a, b})
+
+	data := map[string]interface{}{"rtt": "{{.Item.LastRTT}}", "trace": "{{with .Item.Trace}}{{.Target}}{{end}}", "first": "{{(index .Group 0).Item.LastRTT}}"}
+	rendered := renderTestPayload(t, data, NewTemplateEvent(group, "")).(map[string]interface{})
+	if rendered["rtt"] != "0" || rendered["trace"] != "" || rendered["first"] != "12" {
+		t.Errorf("rendered %v", rendered)
+	}
+
+	// Items lost on the way, such as of a suppressed summary
+	a.Alert.Item = nil
+	rendered = renderTestPayload(t, map[string]interface{}{"size": "{{len .Group}}"}, NewTemplateEvent(NewGroupEvent([]*AlertEvent{a}), "")).(map[string]interface{})
+	if rendered["size"] != "1" {
+		t.Errorf("rendered %v", rendered)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+type Threshold struct {
+	FailAfter    int
+	RecoverAfter int
+	FlapWindow   int
+	FlapChanges  int
+}
+
+// NewThreshold is the threshold of config, counts below 1 are taken as 1
+// as a count of 0 would fail healthy items and recover failing ones.
+func NewThreshold(failAfter int, recoverAfter int, flapWindow int, flapChanges int) *Threshold {
+	if failAfter < 1 {
+		failAfter = 1
+	}
+	if recoverAfter < 1 {
+		recoverAfter = 1
+	}
+	return &Threshold{
+		FailAfter:    failAfter,
+		RecoverAfter: recoverAfter,
+		FlapWindow:   flapWindow,
+		FlapChanges:  flapChanges,
+	}
+}
+
+type CheckState struct {
+	FailCount    int  `json:"consecutive_failures"`
+	SuccessCount int  `json:"consecutive_successes"`
+	IsFlapping   bool `json:"is_flapping"`
+
+	// Latest result of each remediation action of the item
+	Remediations []*RemediationResult `json:"remediations,omitempty"`
+
+	// Set by master for /status
+	State    string    `json:"state,omitempty"`
+	Silence  *Silence  `json:"silence,omitempty"`
+	Incident *Incident `json:"incident,omitempty"`
+
+	isChecked bool
+	history   []bool
+}
+
+// Observe records a raw check result and returns the debounced healthy state.
+// Items start healthy, results must repeat FailAfter or RecoverAfter
+// times before the state changes.
+func (self *CheckState) Observe(ok bool, healthy bool, th *Threshold) bool {
+	if ok {
+		self.SuccessCount++
+		self.FailCount = 0
+	} else {
+		self.FailCount++
+		self.SuccessCount = 0
+	}
+
+	self.updateFlapping(ok, th)
+
+	if !self.isChecked {
+		self.isChecked = true
+		healthy = true
+	}
+
+	if healthy && self.FailCount >= th.FailAfter {
+		return false
+	}
+	if !healthy && self.SuccessCount >= th.RecoverAfter {
+		return true
+	}
+	return healthy
+}
+
+func (self *CheckState) updateFlapping(ok bool, th *Threshold) {
+	if th.FlapWindow <= 0 || th.FlapChanges <= 0 {
+		self.IsFlapping = false
+		return
+	}
+
+	self.history = append(self.history, ok)
+	if len(self.history) > th.FlapWindow {
+		self.history = self.history[len(self.history)-th.FlapWindow:]
+	}
+
+	changes := 0
+	for i := 1; i < len(self.history); i++ {
+		if self.history[i] != self.history[i-1] {
+			changes++
+		}
+	}
+
+	self.IsFlapping = changes >= th.FlapChanges
+}
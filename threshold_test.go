@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+func TestCheckStateObserve(t *testing.T) {
+	tests := []struct {
+		name    string
+		th      Threshold
+		results []bool
+		want    []bool
+	}{
+		{"fail after 1", Threshold{FailAfter: 1, RecoverAfter: 1}, []bool{false, true}, []bool{false, true}},
+		{"first failure waits", Threshold{FailAfter: 3, RecoverAfter: 1}, []bool{false, false, false}, []bool{true, true, false}},
+		{"success resets failures", Threshold{FailAfter: 2, RecoverAfter: 1}, []bool{false, true, false, false}, []bool{true, true, true, false}},
+		{"recover after", Threshold{FailAfter: 1, RecoverAfter: 2}, []bool{false, true, false, true, true}, []bool{false, false, false, false, true}},
+		{"fail after 0", *NewThreshold(0, 1, 0, 0), []bool{true, true, false, true}, []bool{true, true, false, true}},
+		{"recover after 0", *NewThreshold(1, 0, 0, 0), []bool{false, false, true}, []bool{false, false, true}},
+		{"negative", *NewThreshold(-1, -1, 0, 0), []bool{true, false, false, true}, []bool{true, false, false, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var state CheckState
+			healthy := false
+			for i, ok := range tt.results {
+				healthy = state.Observe(ok, healthy, &tt.th)
+				if healthy != tt.want[i] {
+					t.Fatalf("result %d: healthy %v, want %v", i, healthy, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckStateFlapping(t *testing.T) {
+	th := &Threshold{FailAfter: 1, RecoverAfter: 1, FlapWindow: 5, FlapChanges: 3}
+
+	tests := []struct {
+		name     string
+		results  []bool
+		flapping bool
+	}{
+		{"steady", []bool{true, true, true, true, true}, false},
+		{"two changes", []bool{true, false, false, true, true}, false},
+		{"three changes", []bool{true, false, true, false, false}, true},
+		{"changes out of window", []bool{true, false, true, false, false, false, false, false}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var state CheckState
+			healthy := true
+			for _, ok := range tt.results {
+				healthy = state.Observe(ok, healthy, th)
+			}
+			if state.IsFlapping != tt.flapping {
+				t.Fatalf("flapping %v, want %v", state.IsFlapping, tt.flapping)
+			}
+		})
+	}
+}
+
+func TestCheckStateFlappingDisabled(t *testing.T) {
+	var state CheckState
+	th := &Threshold{FailAfter: 1, RecoverAfter: 1}
+	for i := 0; i < 10; i++ {
+		state.Observe(i%2 == 0, true, th)
+	}
+	if state.IsFlapping {
+		t.Fatal("flapping without FlapWindow and FlapChanges")
+	}
+}
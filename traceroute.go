@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	TRACE_PROTOCOL_ICMP = "icmp"
+	TRACE_PROTOCOL_UDP  = "udp"
+
+	traceUdpBasePort = 33434
+)
+
+type TraceRoute struct {
+	Target    string      `json:"target"`
+	Protocol  string      `json:"protocol"`
+	Reached   bool        `json:"reached"`
+	StartTime int64       `json:"start_time_seconds"`
+	Start     string      `json:"start_time"`
+	Hops      []*TraceHop `json:"hops"`
+	Error     string      `json:"error,omitempty"`
+}
+
+type TraceHop struct {
+	TTL     int     `json:"ttl"`
+	IpAddr  string  `json:"ip_addr"`
+	AvgRTT  float64 `json:"avg_rtt_mills"`
+	Sent    int     `json:"sent"`
+	Recv    int     `json:"recv"`
+	Loss    float64 `json:"loss_percent"`
+	Reached bool    `json:"reached"`
+}
+
+func (self *TraceRoute) String() string {
+	var sb strings.Builder
+	for _, v := range self.Hops {
+		if v.Recv == 0 {
+			sb.WriteString(fmt.Sprintf("%2d. *\n", v.TTL))
+		} else {
+			sb.WriteString(fmt.Sprintf("%2d. %s %0.1fms loss %0.0f%%\n", v.TTL, v.IpAddr, v.AvgRTT, v.Loss))
+		}
+	}
+	if self.Error != "" {
+		sb.WriteString(self.Error)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// finish sets the average RTT and loss of a hop from the total RTT of its replies.
+func (self *TraceHop) finish(total time.Duration) {
+	if self.Recv > 0 {
+		self.AvgRTT = float64(total.Microseconds()) / float64(self.Recv) / 1000
+	}
+	if self.Sent > 0 {
+		self.Loss = float64(self.Sent-self.Recv) / float64(self.Sent) * 100
+	}
+}
+
+// Trace runs a bounded traceroute, at most maxHops * probes probes of timeout each.
+func Trace(target string, protocol string, maxHops int, probes int, timeout time.Duration) *TraceRoute {
+	now := time.Now()
+	result := &TraceRoute{
+		Target:    target,
+		Protocol:  protocol,
+		StartTime: now.Unix(),
+		Start:     time.Unix(0, now.UnixNano()).String(),
+	}
+
+	dst := GetIpWithDomainName(target)
+	if dst == nil {
+		result.Error = fmt.Sprintf("can not resolve %s", target)
+		return result
+	}
+
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer conn.Close()
+
+	var udpConn net.PacketConn
+	if protocol == TRACE_PROTOCOL_UDP {
+		udpConn, err = net.ListenPacket("udp4", "0.0.0.0:0")
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		defer udpConn.Close()
+	}
+
+	id := rand.Intn(0xffff)
+	seq := rand.Intn(0xffff)
+
+	for ttl := 1; ttl <= maxHops && !result.Reached; ttl++ {
+		hop := &TraceHop{TTL: ttl}
+		var total time.Duration
+
+		for i := 0; i < probes; i++ {
+			seq = (seq + 1) & 0xffff
+			hop.Sent++
+
+			var sendErr error
+			start := time.Now()
+			if protocol == TRACE_PROTOCOL_UDP {
+				sendErr = traceSendUdp(udpConn, dst, ttl, traceUdpBasePort+ttl*probes+i)
+			} else {
+				sendErr = traceSendIcmp(conn, dst, ttl, id, seq)
+			}
+			if sendErr != nil {
+				result.Error = sendErr.Error()
+				return result
+			}
+
+			peer, reached, ok := traceReceive(conn, protocol, dst, id, seq, traceUdpBasePort+ttl*probes+i, start.Add(timeout))
+			if !ok {
+				continue
+			}
+
+			total += time.Since(start)
+			hop.Recv++
+			hop.IpAddr = peer
+			if reached {
+				hop.Reached = true
+				result.Reached = true
+			}
+		}
+		hop.finish(total)
+
+		LogVerbose("Trace %s ttl %d: %s, %0.1fms, loss %0.0f%%", target, ttl, hop.IpAddr, hop.AvgRTT, hop.Loss)
+		result.Hops = append(result.Hops, hop)
+	}
+
+	return result
+}
+
+func traceSendIcmp(conn *icmp.PacketConn, dst net.IP, ttl int, id int, seq int) error {
+	if err := conn.IPv4PacketConn().SetTTL(ttl); err != nil {
+		return err
+	}
+
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Code: 0,
+		Body: &icmp.Echo{
+			ID:   id,
+			Seq:  seq,
+			Data: []byte("ASM-TRACE"),
+		},
+	}
+
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.WriteTo(b, &net.IPAddr{IP: dst})
+	return err
+}
+
+func traceSendUdp(conn net.PacketConn, dst net.IP, ttl int, port int) error {
+	if err := ipv4.NewPacketConn(conn).SetTTL(ttl); err != nil {
+		return err
+	}
+
+	_, err := conn.WriteTo([]byte("ASM-TRACE"), &net.UDPAddr{IP: dst, Port: port})
+	return err
+}
+
+func traceReceive(conn *icmp.PacketConn, protocol string, dst net.IP, id int, seq int, port int, deadline time.Time) (string, bool, bool) {
+	buf := make([]byte, 1500)
+
+	for {
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return "", false, false
+		}
+
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return "", false, false
+		}
+
+		msg, err := icmp.ParseMessage(1, buf[:n])
+		if err != nil {
+			continue
+		}
+
+		switch body := msg.Body.(type) {
+		case *icmp.Echo:
+			if protocol == TRACE_PROTOCOL_ICMP && msg.Type == ipv4.ICMPTypeEchoReply && body.ID == id && body.Seq == seq {
+				return peer.String(), true, true
+			}
+		case *icmp.TimeExceeded:
+			if traceMatchQuote(body.Data, protocol, dst, id, seq, port) {
+				return peer.String(), false, true
+			}
+		case *icmp.DstUnreach:
+			if traceMatchQuote(body.Data, protocol, dst, id, seq, port) {
+				return peer.String(), peer.String() == dst.String(), true
+			}
+		}
+	}
+}
+
+// traceMatchQuote checks the original datagram quoted in an ICMP error belongs to our probe.
+func traceMatchQuote(data []byte, protocol string, dst net.IP, id int, seq int, port int) bool {
+	if len(data) < ipv4.HeaderLen {
+		return false
+	}
+
+	hl := int(data[0]&0x0f) * 4
+	if len(data) < hl+8 || !net.IP(data[16:20]).Equal(dst) {
+		return false
+	}
+
+	quoted := data[hl:]
+	if protocol == TRACE_PROTOCOL_UDP {
+		return data[9] == 17 && int(binary.BigEndian.Uint16(quoted[2:4])) == port
+	}
+	return data[9] == 1 &&
+		int(binary.BigEndian.Uint16(quoted[4:6])) == id &&
+		int(binary.BigEndian.Uint16(quoted[6:8])) == seq
+}
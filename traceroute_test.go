@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTraceHopFinish(t *testing.T) {
+	tests := []struct {
+		sent, recv int
+		total      time.Duration
+		avg, loss  float64
+	}{
+		{3, 3, 6 * time.Millisecond, 2, 0},
+		{4, 2, 3 * time.Millisecond, 1.5, 50},
+		{2, 0, 0, 0, 100},
+		{0, 0, 0, 0, 0},
+	}
+
+	for _, test := range tests {
+		hop := &TraceHop{Sent: test.sent, Recv: test.recv}
+		hop.finish(test.total)
+		if hop.AvgRTT != test.avg || hop.Loss != test.loss {
+			t.Errorf("%d/%d in %v: avg %v loss %v, want %v %v", test.recv, test.sent, test.total, hop.AvgRTT, hop.Loss, test.avg, test.loss)
+		}
+	}
+}
+
+func TestTraceRouteString(t *testing.T) {
+	trace := &TraceRoute{
+		Hops: []*TraceHop{
+			{TTL: 1, IpAddr: "10.0.0.1", AvgRTT: 1.25, Sent: 2, Recv: 2},
+			{TTL: 2, Sent: 2, Loss: 100},
+			{TTL: 3, IpAddr: "8.8.8.8", AvgRTT: 12, Sent: 2, Recv: 1, Loss: 50, Reached: true},
+		},
+		Error: "timeout",
+	}
+
+	want := " 1. 10.0.0.1 1.2ms loss 0%\n 2. *\n 3. 8.8.8.8 12.0ms loss 50%\ntimeout"
+	if got := trace.String(); got != want {
+		t.Errorf("string %q, want %q", got, want)
+	}
+}
@@ -2,23 +2,29 @@ package main
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"io"
+	"github.com/setreuid/application-server-monitoring/signature"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/exec"
 	"reflect"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// Output of RunCommand is cut at COMMAND_MAX_OUTPUT bytes
+const COMMAND_MAX_OUTPUT = 4096
+
 func MakeLog(tag string, message string, args []interface{}) string {
 	return fmt.Sprintf("[%s/%s %s %s] %7s : %s", NODE_NAME, LOCAL_IPADDR, GetTodayString(), GetTimeString(), tag, fmt.Sprintf(message, args...))
 }
@@ -80,16 +86,25 @@ func CORSMiddleware() gin.HandlerFunc {
 	}
 }
 
+type PostOptions struct {
+	Secret string
+	Client *http.Client
+
+	// Gets the response body when set
+	Response *bytes.Buffer
+}
+
 func Post(url string, headers map[string]string, dataType string, data interface{}) (int, map[string]interface{}, error) {
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	client := http.Client{
-		Timeout:   time.Duration(2) * time.Second,
-		Transport: tr,
+	return PostWithOptions(url, headers, dataType, data, nil)
+}
+
+func PostWithOptions(url string, headers map[string]string, dataType string, data interface{}, options *PostOptions) (int, map[string]interface{}, error) {
+	client := defaultClient
+	if options != nil && options.Client != nil {
+		client = options.Client
 	}
 
-	var reader io.Reader
+	var payload []byte
 
 	if strings.ToUpper(dataType) == "JSON" {
 		jsonString, err := json.Marshal(data)
@@ -97,13 +112,16 @@ func Post(url string, headers map[string]string, dataType string, data interface
 			return 0, nil, err
 		}
 
-		reader = bytes.NewBuffer(jsonString)
+		payload = jsonString
 	} else {
 		params := structToMap(data)
-		reader = strings.NewReader(params.Encode())
+		payload = []byte(params.Encode())
 	}
 
-	req, _ := http.NewRequest("POST", url, reader)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, nil, err
+	}
 
 	if headers != nil {
 		for k, v := range headers {
@@ -111,6 +129,10 @@ func Post(url string, headers map[string]string, dataType string, data interface
 		}
 	}
 
+	if options != nil && options.Secret != "" {
+		req.Header.Set(signature.Header, signature.Sign([]byte(options.Secret), time.Now().Unix(), payload))
+	}
+
 	if strings.ToUpper(dataType) == "JSON" {
 		req.Header.Add("Content-Type", "application/json")
 	} else {
@@ -129,14 +151,39 @@ func Post(url string, headers map[string]string, dataType string, data interface
 		return 0, nil, err
 	}
 
+	if options != nil && options.Response != nil {
+		options.Response.Write(body)
+	}
+
 	var jsonData map[string]interface{}
 	if err := json.Unmarshal(body, &jsonData); err != nil {
-		return 0, nil, err
+		return resp.StatusCode, nil, nil
 	}
 
 	return resp.StatusCode, jsonData, nil
 }
 
+func NewID() string {
+	b := make([]byte, 8)
+	if _, err := crand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// SaveJson writes data to a temporary file first, so a crash does not leave half a file.
+func SaveJson(path string, data interface{}) error {
+	b, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
 func GetTodayString() string {
 	currentTime := time.Now()
 	return currentTime.Format("2006-01-02")
@@ -198,6 +245,13 @@ func ByteCountIEC(b int64) string {
 
 func structToMap(i interface{}) (values url.Values) {
 	values = url.Values{}
+	if m, ok := i.(map[string]interface{}); ok {
+		for k, v := range m {
+			values.Set(k, fmt.Sprint(v))
+		}
+		return
+	}
+
 	iVal := reflect.ValueOf(i).Elem()
 	typ := iVal.Type()
 	for i := 0; i < iVal.NumField(); i++ {
@@ -221,3 +275,52 @@ func structToMap(i interface{}) (values url.Values) {
 	}
 	return
 }
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// RunCommand runs a command with env and stdin until it exits or timeout,
+// returning its exit code and output, -1 on timeout.
+func RunCommand(command string, args []string, env []string, stdin []byte, timeout time.Duration) (int, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Env = env
+
+	// A file rather than a pipe, children left behind by a killed command
+	// would keep a pipe open and Run waiting for them
+	output, err := ioutil.TempFile("", "asm-exec-")
+	if err != nil {
+		return 0, "", err
+	}
+	defer os.Remove(output.Name())
+	defer output.Close()
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	err = cmd.Run()
+	b, _ := ioutil.ReadFile(output.Name())
+	out := strings.TrimSpace(string(b))
+	if len(out) > COMMAND_MAX_OUTPUT {
+		out = out[:COMMAND_MAX_OUTPUT] + "..."
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return -1, out, fmt.Errorf("timeout after %v", timeout)
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode(), out, fmt.Errorf("exit status %d", exitErr.ExitCode())
+	}
+	if err != nil {
+		return 0, out, err
+	}
+	return 0, out, nil
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"github.com/gin-gonic/gin"
 	"io/ioutil"
+	"net/http"
 	"strings"
+	"time"
 )
 
 type WebHook struct {
@@ -13,112 +17,424 @@ type WebHook struct {
 }
 
 type WebHookItem struct {
+	Name     string                 `json:"name"`
+	Type     string                 `json:"type"`
+	Language string                 `json:"language"`
 	EndPoint string                 `json:"end_point"`
 	Headers  map[string]string      `json:"headers"`
 	DataType string                 `json:"data_type"`
 	Data     map[string]interface{} `json:"data"`
+	Routes   []WebHookRoute         `json:"routes"`
+
+	// Notified only by escalation policies
+	EscalationOnly bool `json:"escalation_only"`
+
+	MaxAttempts    int `json:"max_attempts"`
+	BackoffSeconds int `json:"backoff_seconds"`
+
+	// Signs bodies with HMAC-SHA256, see package signature
+	Secret string `json:"secret"`
+
+	TLS            *TLSOptions `json:"tls"`
+	TimeoutSeconds int         `json:"timeout_seconds"`
+
+	// Overrides RATE_PER_MINUTE and RATE_BURST of [DELIVERY]
+	RateLimit *RateLimit `json:"rate_limit"`
+
+	// Telegram
+	ChatID string `json:"chat_id"`
+
+	// PagerDuty, Opsgenie
+	RoutingKey  string            `json:"routing_key"`
+	ApiKey      string            `json:"api_key"`
+	SeverityMap map[string]string `json:"severity_map"`
+
+	// Email
+	Smtp *SmtpConfig `json:"smtp"`
+	To   []string    `json:"to"`
+	Cc   []string    `json:"cc"`
+
+	// Exec, runs with ASM_* and "env" environment variables
+	Command string            `json:"command"`
+	Args    []string          `json:"args"`
+	Env     map[string]string `json:"env"`
+
+	payload  interface{}
+	notifier Notifier
+	client   *http.Client
+	response *bytes.Buffer
+	limiter  *RateLimiter
 }
 
-func (self *WebHook) Init() {
+type WebHookTestRequest struct {
+	CheckType string `json:"check_type"`
+	Kind      string `json:"kind"`
+	DryRun    bool   `json:"dry_run"`
+}
+
+type WebHookTestResult struct {
+	Hook     string      `json:"hook"`
+	DryRun   bool        `json:"dry_run"`
+	Event    *AlertEvent `json:"event"`
+	Content  string      `json:"content"`
+	Payload  interface{} `json:"payload"`
+	Status   int         `json:"status"`
+	Response string      `json:"response"`
+	Error    string      `json:"error"`
+	Latency  int64       `json:"latency_mills"`
+}
+
+func (self *WebHook) Init() error {
 	// Init
 	b, err := ioutil.ReadFile(WEB_HOOK_CONFIG_JSON)
 	if err != nil {
 		LogFatal("Web hook initialing failed.")
 		LogFatal("Can not read %s file unmarshal (%v).", WEB_HOOK_CONFIG_JSON, err)
-		return
+		return err
 	}
 
 	var data []WebHookItem
 	if err := json.Unmarshal(b, &data); err != nil {
 		LogFatal("Web hook initialing failed.")
 		LogFatal("Error on %s file unmarshal (%v).", WEB_HOOK_CONFIG_JSON, err)
-		return
+		return err
+	}
+
+	// Queues, dead letters and replays go by name
+	names := make(map[string]bool)
+	for i := range data {
+		if data[i].Name == "" {
+			data[i].Name = fmt.Sprintf("hook%d", i)
+		}
+		if names[data[i].Name] {
+			err := fmt.Errorf("duplicate web hook name %s", data[i].Name)
+			LogFatal("Web hook initialing failed.")
+			LogFatal("Error on %s (%v).", WEB_HOOK_CONFIG_JSON, err)
+			return err
+		}
+		names[data[i].Name] = true
+
+		payload, err := CompilePayload("data", map[string]interface{}(data[i].Data), self.legacyVars)
+		if err != nil {
+			LogFatal("Web hook initialing failed.")
+			LogFatal("Error on %s template of web hook %d (%v).", WEB_HOOK_CONFIG_JSON, i, err)
+			return err
+		}
+		data[i].payload = payload
+
+		client, err := NewHttpClient(data[i].TLS, data[i].TimeoutSeconds)
+		if err != nil {
+			LogFatal("Web hook initialing failed.")
+			LogFatal("Error on %s tls of web hook %s (%v).", WEB_HOOK_CONFIG_JSON, data[i].Name, err)
+			return err
+		}
+		data[i].client = client
+
+		notifier, err := NewNotifier(&data[i])
+		if err != nil {
+			LogFatal("Web hook initialing failed.")
+			LogFatal("Error on %s web hook %d (%v).", WEB_HOOK_CONFIG_JSON, i, err)
+			return err
+		}
+		data[i].notifier = notifier
+
+		limit := RateLimit{PerMinute: DELIVERY_RATE_PER_MINUTE, Burst: DELIVERY_RATE_BURST}
+		if data[i].RateLimit != nil {
+			limit = *data[i].RateLimit
+		}
+		if limit.PerMinute > 0 {
+			if !data[i].IsGroupable() {
+				LogInfo("Web hook %s is not rate limited, it notifies by item.", data[i].Name)
+			} else {
+				item := &data[i]
+				data[i].limiter = NewRateLimiter(limit, func(events []*AlertEvent) {
+					self.sendSuppressed(item, events)
+				})
+			}
+		}
 	}
 
 	self.items = data
 	self.isEnabled = true
+	return nil
 }
 
-func (self *WebHook) SendHeartBeatWarning(nodeName string, nodeIpAddr string, item *HeartbeatItem) {
-	self.Send(fmt.Sprintf("[%s/%s] %s (%s) Heartbeat 다운 경고\n\n- 마지막 동작 시간\n%s",
-		nodeName,
-		nodeIpAddr,
-		item.Name,
-		item.ID,
-		item.LastCheck,
-	))
+// Notify sends an event to the matching web hooks. Each hook gets the
+// members of a group event it matches, combined unless it pages per item.
+func (self *WebHook) Notify(event *AlertEvent) {
+	members := event.Group
+	if len(members) == 0 {
+		members = []*AlertEvent{event}
+	}
+
+	// Escalated hooks are told as well, they were paged
+	for _, v := range members {
+		if v.Kind == ALERT_EVENT_RESOLVED {
+			es.Resolve(v)
+		}
+	}
+
+	for i := range self.items {
+		item := &self.items[i]
+		if item.EscalationOnly {
+			continue
+		}
+
+		var matched []*AlertEvent
+		for _, v := range members {
+			if route := item.Route(&v.Alert); route != nil {
+				matched = append(matched, v)
+				if route.Escalation != "" {
+					es.Track(v, route.Escalation)
+				}
+			} else {
+				LogVerbose("Web hook %s skipped %s", item.Name, v.Alert.Key)
+			}
+		}
+
+		if len(matched) == 0 {
+			continue
+		}
+
+		catalog := GetCatalog(item.Language)
+		if len(matched) > 1 && item.IsGroupable() {
+			group := NewGroupEvent(matched)
+			self.Send(item, group, catalog.AlertMessage(group))
+			continue
+		}
+
+		for _, v := range matched {
+			self.Send(item, v, catalog.AlertMessage(v))
+		}
+	}
 }
 
-func (self *WebHook) SendPingWarning(nodeName string, nodeIpAddr string, item *PingItem) {
-	self.Send(fmt.Sprintf("[%s/%s] %s (%s) Ping 다운 경고\n\n- 마지막 확인 시간\n%s\n- 마지막 RTT\n%d",
-		nodeName,
-		nodeIpAddr,
-		item.Name,
-		item.IpAddr,
-		item.LastCheck,
-		item.LastRTT,
-	))
+// IsGroupable is false for paging hooks, which dedup by item, and for exec hooks,
+// whose commands take one alert. Such hooks are not rate limited nor sent reports.
+func (self *WebHookItem) IsGroupable() bool {
+	return self.Type != NOTIFIER_TYPE_PAGERDUTY && self.Type != NOTIFIER_TYPE_OPSGENIE && self.Type != NOTIFIER_TYPE_EXEC
 }
 
-func (self *WebHook) SendHddWaring(nodeName string, nodeIpAddr string, item *HDDItem) {
-	self.Send(fmt.Sprintf("[%s/%s] %s (%s) Disk 사용량 경고\n\n- 마지막 확인 시간\n%s\n- 사용율\n%0.2f%%\n- 총 공간\n%s\n- 사용중인 공간\n%s\n- 잔여 공간\n%s",
-		nodeName,
-		nodeIpAddr,
-		item.Name,
-		item.Path,
-		item.LastCheck,
-		item.Usage,
-		item.Total,
-		item.Used,
-		item.Free,
-	))
+func (self *WebHookItem) PostOptions() *PostOptions {
+	return &PostOptions{
+		Secret:   self.Secret,
+		Client:   self.client,
+		Response: self.response,
+	}
 }
 
-func (self *WebHook) CheckHeartBeat(node *NodeData) {
-	for _, x := range node.HeartbeatItems {
-		if !x.IsOnline {
-			wh.SendHeartBeatWarning(node.Name, node.IpAddr, x)
+// Test renders a synthetic alert for a hook and delivers it at once,
+// skipping routes and the queue, and returns what the receiver answered.
+func (self *WebHook) Test(c *gin.Context) {
+	item := self.Item(c.Param("name"))
+	if item == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "No matching web hook."})
+		return
+	}
+
+	req := WebHookTestRequest{CheckType: CHECK_TYPE_PING, Kind: ALERT_EVENT_FIRING}
+	if c.Request.ContentLength > 0 {
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid arguments."})
+			return
 		}
 	}
+
+	event := NewTestEvent(req.CheckType, req.Kind)
+	if event == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid check_type or kind."})
+		return
+	}
+
+	// A copy of the hook keeps the response body
+	test := *item
+	test.response = &bytes.Buffer{}
+	notifier, err := NewNotifier(&test)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	result := &WebHookTestResult{
+		Hook:    item.Name,
+		DryRun:  DRY_RUN || req.DryRun,
+		Event:   event,
+		Content: GetCatalog(item.Language).AlertMessage(event),
+	}
+
+	if result.Payload, err = notifier.Render(event, result.Content); err != nil {
+		result.Error = err.Error()
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	if result.DryRun {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	start := time.Now()
+	status, output, err := DeliverOutput(notifier, result.Payload)
+	latency := time.Since(start)
+
+	result.Status = status
+	result.Response = test.response.String()
+	if output != "" {
+		result.Response = output
+	}
+	result.Latency = latency.Milliseconds()
+
+	d := &Delivery{ID: NewID(), Hook: item.Name, Event: event, Payload: result.Payload, Attempts: 1, LastStatus: status, LastOutput: output}
+	if err != nil {
+		result.Error = err.Error()
+		d.LastError = result.Error
+		au.Attempt(d, AUDIT_RESULT_FAILED, latency)
+	} else {
+		au.Attempt(d, AUDIT_RESULT_DELIVERED, latency)
+	}
+
+	LogInfo("Web hook %s tested (%d, %s)", item.Name, status, result.Error)
+	c.JSON(http.StatusOK, result)
+}
+
+// NewTestEvent is a firing or resolved alert of a made up item on this node.
+// Its key starts with test/, so it never dedups with a real alert of the node.
+func NewTestEvent(checkType string, kind string) *AlertEvent {
+	now := time.Now()
+	node := &NodeData{Name: NODE_NAME, IpAddr: LOCAL_IPADDR}
+
+	switch checkType {
+	case CHECK_TYPE_HEARTBEAT:
+		node.HeartbeatItems = []*HeartbeatItem{{
+			Name:          "test",
+			ID:            "test",
+			LastCheckTime: now.Add(-time.Minute).Unix(),
+			LastCheck:     now.Add(-time.Minute).Format("2006-01-02 15:04:05"),
+			IsOnline:      kind == ALERT_EVENT_RESOLVED,
+		}}
+	case CHECK_TYPE_PING:
+		node.PingItems = []*PingItem{{
+			Name:          "test",
+			IpAddr:        "127.0.0.1",
+			LastCheckTime: now.Unix(),
+			LastCheck:     now.Format("2006-01-02 15:04:05"),
+			LastRTT:       12,
+			IsOnline:      kind == ALERT_EVENT_RESOLVED,
+		}}
+	case CHECK_TYPE_HDD:
+		node.HddItems = []*HDDItem{{
+			Name:          "test",
+			Path:          "/",
+			LastCheckTime: now.Unix(),
+			LastCheck:     now.Format("2006-01-02 15:04:05"),
+			Usage:         91.5,
+			Total:         "100.0 GB",
+			Used:          "91.5 GB",
+			Free:          "8.5 GB",
+			IsWarning:     kind != ALERT_EVENT_RESOLVED,
+		}}
+	default:
+		return nil
+	}
+
+	x := AlertItems(node, checkType)[0]
+	alert := x.NewAlert(node)
+	alert.Key = "test/" + alert.Key
+	alert.Labels = map[string]string{}
+	alert.StartsAt = now.Add(-time.Minute * 5)
+
+	switch kind {
+	case ALERT_EVENT_FIRING, ALERT_EVENT_REMINDER:
+		alert.State = ALERT_STATE_FIRING
+		return &AlertEvent{Kind: kind, OldState: ALERT_STATE_OK, NewState: ALERT_STATE_FIRING, Time: now, Alert: *alert}
+	case ALERT_EVENT_RESOLVED:
+		alert.State = ALERT_STATE_OK
+		alert.EndsAt = now
+		return &AlertEvent{Kind: kind, OldState: ALERT_STATE_FIRING, NewState: ALERT_STATE_OK, Time: now, Alert: *alert}
+	}
+	return nil
 }
 
-func (self *WebHook) CheckPing(node *NodeData) {
-	for _, x := range node.PingItems {
-		if !x.IsOnline {
-			wh.SendPingWarning(node.Name, node.IpAddr, x)
+// MapSeverity maps our severity by severity_map of the hook, then by defaults.
+func (self *WebHookItem) MapSeverity(severity string, defaults map[string]string, fallback string) string {
+	if v, ok := self.SeverityMap[severity]; ok {
+		return v
+	}
+	if v, ok := defaults[severity]; ok {
+		return v
+	}
+	return fallback
+}
+
+// Route returns the first route of the hook matching an alert, nil if none.
+func (self *WebHookItem) Route(alert *Alert) *WebHookRoute {
+	if len(self.Routes) == 0 {
+		route := &WebHookRoute{}
+		if route.Match(alert) {
+			return route
+		}
+		return nil
+	}
+
+	for i := range self.Routes {
+		if self.Routes[i].Match(alert) {
+			return &self.Routes[i]
 		}
 	}
+	return nil
 }
 
-func (self *WebHook) CheckHdd(node *NodeData) {
-	for _, x := range node.HddItems {
-		if x.IsWarning {
-			wh.SendHddWaring(node.Name, node.IpAddr, x)
+func (self *WebHook) Item(name string) *WebHookItem {
+	for i := range self.items {
+		if self.items[i].Name == name {
+			return &self.items[i]
 		}
 	}
+	return nil
 }
 
-func (self *WebHook) Send(content string) {
+func (self *WebHook) Send(item *WebHookItem, event *AlertEvent, content string) {
 	if !self.isEnabled {
 		return
 	}
 
-	for _, item := range self.items {
-		data := make(map[string]interface{})
+	// Reports are scheduled, they are not folded into a suppressed summary
+	if item.limiter != nil && event.Kind != ALERT_EVENT_REPORT && !item.limiter.Allow() {
+		LogDebug("Web hook %s over rate limit, %s suppressed", item.Name, event.Alert.Key)
+		item.limiter.Suppress(event)
+		return
+	}
 
-		for k, v := range item.Data {
-			switch v := v.(type) {
-			case string:
-				data[k] = self.VarMatching(v, content)
-			case fmt.Stringer:
-				data[k] = self.VarMatching(v.String(), content)
-			default:
-				data[k] = v
-			}
+	self.enqueue(item, event, content)
+}
+
+// sendSuppressed folds the events held back by the rate limit into one message.
+func (self *WebHook) sendSuppressed(item *WebHookItem, events []*AlertEvent) {
+	var members []*AlertEvent
+	for _, v := range events {
+		if len(v.Group) > 0 {
+			members = append(members, v.Group...)
+		} else {
+			members = append(members, v)
 		}
+	}
+
+	group := NewGroupEvent(members)
+	group.Kind = ALERT_EVENT_SUPPRESSED
+	group.Time = time.Now()
+
+	LogInfo("Web hook %s sends %d suppressed alerts", item.Name, len(members))
+	self.enqueue(item, group, GetCatalog(item.Language).Message("group.suppressed", NewTemplateEvent(group, "")))
+}
 
-		go Post(item.EndPoint, item.Headers, item.DataType, data)
+func (self *WebHook) enqueue(item *WebHookItem, event *AlertEvent, content string) {
+	payload, err := item.notifier.Render(event, content)
+	if err != nil {
+		LogFatal("Web hook %s render failed (%v).", item.Name, err)
+		return
 	}
+
+	dq.Enqueue(item.Name, event, payload)
 }
 
 func (self *WebHook) VarMatching(target string, content string) string {
@@ -127,3 +443,8 @@ func (self *WebHook) VarMatching(target string, content string) string {
 	target = strings.ReplaceAll(target, "%CONTENT%", content)
 	return target
 }
+
+// legacyVars turns %VAR% of older configs into template actions.
+func (self *WebHook) legacyVars(target string) string {
+	return self.VarMatching(target, "{{.Content}}")
+}